@@ -0,0 +1,177 @@
+package slacktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxJournalMemory is the most memory used to parse a multipart request for the journal
+const maxJournalMemory = 32 << 20
+
+// APICall is a Web API request handled by the server
+type APICall struct {
+	// Method is the Web API method such as `chat.postMessage`
+	Method string
+	// Params are the query, form or top level json parameters of the request.
+	// Non-string json values are kept as json
+	Params     url.Values
+	Token      string
+	Header     http.Header
+	Status     int
+	Response   string
+	ReceivedAt time.Time
+	Duration   time.Duration
+}
+
+type apiJournal struct {
+	sync.RWMutex
+	calls []APICall
+}
+
+func (j *apiJournal) add(c APICall) {
+	j.Lock()
+	j.calls = append(j.calls, c)
+	j.Unlock()
+}
+
+// byMethod returns the calls to `method`, or every call if `method` is empty
+func (j *apiJournal) byMethod(method string) []APICall {
+	j.RLock()
+	defer j.RUnlock()
+	var calls []APICall
+	for _, c := range j.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// journalResponseWriter keeps a copy of the response written by a handler
+type journalResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (jw *journalResponseWriter) WriteHeader(status int) {
+	if jw.status == 0 {
+		jw.status = status
+	}
+	jw.ResponseWriter.WriteHeader(status)
+}
+
+func (jw *journalResponseWriter) Write(b []byte) (int, error) {
+	if jw.status == 0 {
+		jw.status = http.StatusOK
+	}
+	jw.body.Write(b)
+	return jw.ResponseWriter.Write(b)
+}
+
+// journalHandler records every Web API request handled by `next` in the server's journal.
+// The websocket endpoint and file downloads are not Web API methods and aren't journaled
+func journalHandler(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		call := APICall{
+			Method:     apiMethod(r),
+			Header:     r.Header,
+			ReceivedAt: time.Now(),
+		}
+		params, err := journalParams(r)
+		if err != nil {
+			log.Printf("Unable to parse params for journal: %s", err.Error())
+		}
+		call.Params = params
+		call.Token = requestToken(r, params)
+		jw := &journalResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(jw, r)
+		call.Duration = time.Since(call.ReceivedAt)
+		call.Status = jw.status
+		call.Response = jw.body.String()
+		s.apiCalls.add(call)
+	})
+}
+
+// journalParams parses the parameters of `r` without consuming its body
+func journalParams(r *http.Request) (url.Values, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	params := url.Values{}
+	for k, v := range r.URL.Query() {
+		params[k] = v
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json":
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return params, err
+		}
+		for k, raw := range fields {
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				params.Add(k, s)
+				continue
+			}
+			params.Add(k, string(raw))
+		}
+	case strings.HasPrefix(mediaType, "multipart/"):
+		clone := r.WithContext(r.Context())
+		clone.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := clone.ParseMultipartForm(maxJournalMemory); err != nil {
+			return params, err
+		}
+		for k, v := range clone.MultipartForm.Value {
+			params[k] = append(params[k], v...)
+		}
+	case r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return params, err
+		}
+		for k, v := range values {
+			params[k] = append(params[k], v...)
+		}
+	}
+	return params, nil
+}
+
+// requestToken returns the token passed as a parameter or a bearer token
+func requestToken(r *http.Request, params url.Values) string {
+	if t := params.Get("token"); t != "" {
+		return t
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// APICalls returns the Web API calls made to `method` such as `chat.postMessage`, oldest first.
+// An empty `method` returns every call
+func (sts *Server) APICalls(method string) []APICall {
+	return sts.apiCalls.byMethod(method)
+}
+
+// LastAPICall returns the most recent Web API call made to `method`
+func (sts *Server) LastAPICall(method string) (APICall, bool) {
+	calls := sts.apiCalls.byMethod(method)
+	if len(calls) == 0 {
+		return APICall{}, false
+	}
+	return calls[len(calls)-1], true
+}
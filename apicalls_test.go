@@ -0,0 +1,68 @@
+package slacktest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPICallsJournal(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	params := slack.NewPostMessageParameters()
+	params.IconEmoji = ":ghost:"
+	params.UnfurlLinks = true
+	params.AsUser = true
+	_, _, err := client.PostMessage("C024BE91L", "first", params)
+	assert.NoError(t, err)
+	_, _, err = client.PostMessage("C024BE91L", "second", params)
+	assert.NoError(t, err)
+	_, err = client.GetUserInfo("W012A3CDE")
+	assert.NoError(t, err)
+
+	calls := s.APICalls("chat.postMessage")
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "first", calls[0].Params.Get("text"))
+	}
+	last, ok := s.LastAPICall("chat.postMessage")
+	if assert.True(t, ok) {
+		assert.Equal(t, "chat.postMessage", last.Method)
+		assert.Equal(t, "second", last.Params.Get("text"))
+		assert.Equal(t, ":ghost:", last.Params.Get("icon_emoji"))
+		assert.Equal(t, "true", last.Params.Get("unfurl_links"))
+		assert.Equal(t, "true", last.Params.Get("as_user"))
+		assert.Equal(t, "ABCDEFG", last.Token)
+		assert.Equal(t, http.StatusOK, last.Status)
+		assert.Contains(t, last.Response, `"ok":true`)
+		assert.False(t, last.ReceivedAt.IsZero())
+	}
+	assert.Len(t, s.APICalls(""), 3)
+	_, ok = s.LastAPICall("chat.update")
+	assert.False(t, ok)
+	s.Stop()
+}
+
+func TestAPICallsJournalJSON(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	req, _ := http.NewRequest(http.MethodPost, s.GetAPIURL()+"chat.postMessage", strings.NewReader(`{"channel":"C024BE91L","text":"json body","unfurl_links":false}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer xoxb-json")
+	resp, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		_ = resp.Body.Close()
+	}
+	last, ok := s.LastAPICall("chat.postMessage")
+	if assert.True(t, ok) {
+		assert.Equal(t, "json body", last.Params.Get("text"))
+		assert.Equal(t, "false", last.Params.Get("unfurl_links"))
+		assert.Equal(t, "xoxb-json", last.Token)
+		assert.Equal(t, "Bearer xoxb-json", last.Header.Get("Authorization"))
+	}
+	s.Stop()
+}
@@ -0,0 +1,172 @@
+package slacktest
+
+import (
+	"strings"
+
+	slack "github.com/nlopes/slack"
+)
+
+// the conversation types conversations.list can filter by
+const (
+	conversationPublic  = "public_channel"
+	conversationPrivate = "private_channel"
+	conversationMPIM    = "mpim"
+	conversationIM      = "im"
+)
+
+func channelConversation(c slack.Channel, user string) conversationInfo {
+	topic, purpose := c.Topic, c.Purpose
+	return conversationInfo{
+		ID:         c.ID,
+		Name:       c.Name,
+		Created:    c.Created,
+		Creator:    c.Creator,
+		IsChannel:  true,
+		IsArchived: c.IsArchived,
+		IsGeneral:  c.IsGeneral,
+		IsMember:   c.IsMember || hasMember(c.Members, user),
+		Topic:      &topic,
+		Purpose:    &purpose,
+		NumMembers: len(c.Members),
+		members:    c.Members,
+	}
+}
+
+func groupConversation(g slack.Group, user string) conversationInfo {
+	topic, purpose := g.Topic, g.Purpose
+	return conversationInfo{
+		ID:         g.ID,
+		Name:       g.Name,
+		Created:    g.Created,
+		Creator:    g.Creator,
+		IsGroup:    true,
+		IsPrivate:  true,
+		IsArchived: g.IsArchived,
+		IsMember:   hasMember(g.Members, user),
+		Topic:      &topic,
+		Purpose:    &purpose,
+		NumMembers: len(g.Members),
+		members:    g.Members,
+	}
+}
+
+// imConversation describes `im` as seen by `user`
+func imConversation(im slack.IM, user string) conversationInfo {
+	return conversationInfo{
+		ID:         im.ID,
+		Created:    im.Created,
+		IsIM:       true,
+		IsPrivate:  true,
+		IsMember:   true,
+		IsOpen:     im.IsOpen,
+		User:       im.User,
+		NumMembers: 2,
+		members:    []string{user, im.User},
+	}
+}
+
+func mpimConversation(g slack.Group) conversationInfo {
+	c := groupConversation(g, g.Creator)
+	c.IsGroup = false
+	c.IsMpim = true
+	c.IsMember = true
+	c.IsOpen = g.IsOpen
+	return c
+}
+
+// conversationType returns the conversations.list type of `c`
+func conversationType(c conversationInfo) string {
+	switch {
+	case c.IsIM:
+		return conversationIM
+	case c.IsMpim:
+		return conversationMPIM
+	case c.IsPrivate:
+		return conversationPrivate
+	default:
+		return conversationPublic
+	}
+}
+
+// parseConversationTypes returns the comma separated conversation `types`, defaulting to public channels.
+// It reports whether every type is known
+func parseConversationTypes(types string) ([]string, bool) {
+	if types == "" {
+		return []string{conversationPublic}, true
+	}
+	var parsed []string
+	for _, t := range strings.Split(types, ",") {
+		switch t = strings.TrimSpace(t); t {
+		case conversationPublic, conversationPrivate, conversationMPIM, conversationIM:
+			parsed = append(parsed, t)
+		default:
+			return nil, false
+		}
+	}
+	return parsed, true
+}
+
+// conversations returns the channels and groups in the workspace followed by the direct messages `user` is a member of
+func (sts *Server) conversations(user string) []conversationInfo {
+	var conversations []conversationInfo
+	for _, c := range sts.channels.all() {
+		conversations = append(conversations, channelConversation(c, user))
+	}
+	for _, g := range sts.groups.all() {
+		conversations = append(conversations, groupConversation(g, user))
+	}
+	for _, im := range sts.ims.forUser(user) {
+		conversations = append(conversations, imConversation(im, user))
+	}
+	for _, g := range sts.mpims.forUser(user) {
+		conversations = append(conversations, mpimConversation(g))
+	}
+	return conversations
+}
+
+// conversation returns the channel or group `id`, or the direct message `id` if `user` is a member of it
+func (sts *Server) conversation(user, id string) (conversationInfo, bool) {
+	if c, ok := sts.channels.get(id); ok {
+		return channelConversation(c, user), true
+	}
+	if g, ok := findGroup(sts.GetGroups(), id); ok {
+		return groupConversation(g, user), true
+	}
+	if im, ok := sts.ims.get(user, id); ok {
+		return imConversation(im, user), true
+	}
+	if g, ok := sts.mpims.get(user, id); ok {
+		return mpimConversation(g), true
+	}
+	return conversationInfo{}, false
+}
+
+// nameTaken reports whether a channel or group is already called `name`
+func (sts *Server) nameTaken(name string) bool {
+	if _, taken := sts.channels.byName(name); taken {
+		return true
+	}
+	for _, g := range sts.groups.all() {
+		if g.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// createGroup creates the private channel `name` with `creator` as its only member and notifies connected clients
+func (sts *Server) createGroup(name, creator, source string) slack.Group {
+	g := slack.Group{IsGroup: true}
+	g.ID = newID("G")
+	g.Name = name
+	g.Created = nowAsJSONTime()
+	g.Creator = creator
+	g.IsOpen = true
+	g.Members = []string{creator}
+	sts.groups.add(g)
+	queueEventForWebsocket(groupJoinedEvent{
+		Type:    "group_joined",
+		Channel: g,
+	}, sts.ServerAddr, source)
+	return g
+}
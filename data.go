@@ -1,6 +1,7 @@
 package slacktest
 
 import (
+	"encoding/json"
 	"fmt"
 
 	slack "github.com/nlopes/slack"
@@ -34,20 +35,6 @@ var okWebResponse = slack.WebResponse{
 	Ok: true,
 }
 
-var defaultChannelsListJSON = fmt.Sprintf(`
-	{
-		"ok": true,
-		"channels": [%s, %s]
-	}
-	`, defaultGeneralChannelJSON, defaultExtraChannelJSON)
-
-var defaultGroupsListJSON = fmt.Sprintf(`
-		{
-			"ok": true,
-			"groups": [%s]
-		}
-		`, defaultGroupJSON)
-
 var defaultUsersInfoJSON = fmt.Sprintf(`
 	{
 		"ok":true,
@@ -176,3 +163,49 @@ var defaultNonBotUser = fmt.Sprintf(`
 			"locale": "en-US"
 		}
 	`, defaultNonBotUserID, defaultTeamID, defaultNonBotUserName, defaultNonBotUserName, defaultNonBotUserName, defaultTeamID)
+
+// newDefaultNonBotUser returns a copy of the default human user
+func newDefaultNonBotUser() slack.User {
+	resp := struct {
+		User slack.User `json:"user"`
+	}{}
+	if err := json.Unmarshal([]byte(defaultUsersInfoJSON), &resp); err != nil {
+		panic(fmt.Sprintf("unable to decode default user: %s", err.Error()))
+	}
+	return resp.User
+}
+
+// newDefaultChannels returns the channels every new server starts with
+func newDefaultChannels() []slack.Channel {
+	var channels []slack.Channel
+	for _, j := range []string{defaultGeneralChannelJSON, defaultExtraChannelJSON} {
+		c := slack.Channel{}
+		if err := json.Unmarshal([]byte(j), &c); err != nil {
+			panic(fmt.Sprintf("unable to decode default channel: %s", err.Error()))
+		}
+		channels = append(channels, c)
+	}
+	return channels
+}
+
+// newDefaultGroups returns the groups every new server starts with
+func newDefaultGroups() []slack.Group {
+	g := slack.Group{}
+	if err := json.Unmarshal([]byte(defaultGroupJSON), &g); err != nil {
+		panic(fmt.Sprintf("unable to decode default group: %s", err.Error()))
+	}
+	return []slack.Group{g}
+}
+
+// newBotUser returns the user entry for the bot
+func newBotUser(id, name string) slack.User {
+	return slack.User{
+		ID:       id,
+		Name:     name,
+		IsBot:    true,
+		Presence: "active",
+		Profile: slack.UserProfile{
+			RealName: name,
+		},
+	}
+}
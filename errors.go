@@ -12,3 +12,45 @@ var ErrPassedEmptyServerAddr = fmt.Errorf("Passed an empty server address")
 
 // ErrNoQueuesRegisteredForServer is the error when there are no queues for a server in the hub
 var ErrNoQueuesRegisteredForServer = fmt.Errorf("No queues registered for server")
+
+// ErrChannelNotFound is the error when there is no channel or group with the requested id
+var ErrChannelNotFound = fmt.Errorf("No channel or group found with that id")
+
+// ErrUserNotFound is the error when there is no user with the requested id
+var ErrUserNotFound = fmt.Errorf("No user found with that id")
+
+// ErrInvalidCursor is the error when a pagination cursor can't be decoded
+var ErrInvalidCursor = fmt.Errorf("Invalid pagination cursor")
+
+// ErrNoServerInContext is the error when a handler is called without a Server in its context
+var ErrNoServerInContext = fmt.Errorf("No server found in context")
+
+// ErrMessageNotFound is the error when there is no message with the requested channel and timestamp
+var ErrMessageNotFound = fmt.Errorf("No message found with that channel and timestamp")
+
+// ErrAlreadyReacted is the error when a user already reacted to a message with the same emoji
+var ErrAlreadyReacted = fmt.Errorf("User already reacted with that emoji")
+
+// ErrNoReaction is the error when a user hasn't reacted to a message with an emoji
+var ErrNoReaction = fmt.Errorf("User has not reacted with that emoji")
+
+// ErrInvalidReaction is the error when a reaction has no emoji name
+var ErrInvalidReaction = fmt.Errorf("Invalid emoji name")
+
+// ErrNotEnoughUsers is the error when a multi-party direct message is opened with fewer than two other users
+var ErrNotEnoughUsers = fmt.Errorf("Not enough users for a multi-party direct message")
+
+// ErrTooManyUsers is the error when a multi-party direct message is opened with more than eight other users
+var ErrTooManyUsers = fmt.Errorf("Too many users for a multi-party direct message")
+
+// ErrFileNotFound is the error when there is no file with the requested id
+var ErrFileNotFound = fmt.Errorf("No file found with that id")
+
+// ErrNoClientsConnected is the error when an event is sent with ErrorWhenNoClients and no websocket client is connected
+var ErrNoClientsConnected = fmt.Errorf("No websocket clients connected")
+
+// ErrOutboundQueueFull is the error when an event is sent while the outbound buffer is full
+var ErrOutboundQueueFull = fmt.Errorf("Outbound websocket queue is full")
+
+// ErrConnectionNotFound is the error when no websocket client is connected with an id
+var ErrConnectionNotFound = fmt.Errorf("No websocket connection with that id")
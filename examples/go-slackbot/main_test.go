@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 	"time"
@@ -11,6 +12,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+const maxWait = 5 * time.Second
+
 func TestGlobalMessageHandler(t *testing.T) {
 	s := slacktest.NewTestServer()
 	s.SetBotName("TestSlackBot")
@@ -20,7 +23,10 @@ func TestGlobalMessageHandler(t *testing.T) {
 	configureBot(bot)
 	go bot.Run()
 	s.SendMessageToChannel("C024BE91L", "global message")
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForMessage(ctx, slacktest.MessageWithText("I see your global message"))
+	assert.NoError(t, err, "bot did not respond in time")
 	assert.True(t, s.SawMessage("I see your global message"), "bot did not respond correctly")
 	s.Stop()
 }
@@ -34,7 +40,10 @@ func TestHelloMessageHandler(t *testing.T) {
 	configureBot(bot)
 	go bot.Run()
 	s.SendMessageToBot("#C024BE91L", "greetings and salutations")
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForMessage(ctx, slacktest.MessageWithText("hi there to you too!"))
+	assert.NoError(t, err, "bot did not respond in time")
 	assert.True(t, s.SawMessage("hi there to you too!"), "bot did not respond correctly")
 	s.Stop()
 }
@@ -48,7 +57,10 @@ func TestDirectMessageHandler(t *testing.T) {
 	configureBot(bot)
 	go bot.Run()
 	s.SendDirectMessageToBot("wanna chat?")
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForMessage(ctx, slacktest.MessageWithText("sorry I can't do direct messages"))
+	assert.NoError(t, err, "bot did not respond in time")
 	assert.True(t, s.SawMessage("sorry I can't do direct messages"), "bot did not respond correctly")
 	s.Stop()
 }
@@ -62,7 +74,10 @@ func TestPostMessageHandler(t *testing.T) {
 	//bot.Client.SetDebug(true)
 	go bot.Run()
 	s.SendMessageToChannel("C024BE91L", "send to api")
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, slacktest.MessageWithText("posting to a channel via api"))
+	assert.NoError(t, err, "bot did not respond in time")
 	seenMessages := s.GetSeenOutboundMessages()
 	if !assert.Len(t, seenMessages, 2, "should only have two messages") {
 		t.FailNow()
@@ -82,7 +97,10 @@ func TestPostAttachmentHandler(t *testing.T) {
 	//bot.Client.SetDebug(true)
 	go bot.Run()
 	s.SendMessageToChannel("C024BE91L", "send an attachment")
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, func(m *slack.MessageEvent) bool { return len(m.Attachments) > 0 })
+	assert.NoError(t, err, "bot did not respond in time")
 	seenMessages := s.GetSeenOutboundMessages()
 	if !assert.Len(t, seenMessages, 2, "should only have two messages") {
 		t.FailNow()
@@ -104,7 +122,10 @@ func TestChannelJoinHandler(t *testing.T) {
 	//bot.Client.SetDebug(true)
 	go bot.Run()
 	s.SendBotChannelInvite()
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, slacktest.MessageWithText("thanks for the invite"))
+	assert.NoError(t, err, "bot did not respond in time")
 	seenMessages := s.GetSeenOutboundMessages()
 	if !assert.Len(t, seenMessages, 2, "should only have two messages") {
 		t.FailNow()
@@ -127,7 +148,10 @@ func TestChannelJoinHandlerGroup(t *testing.T) {
 	//bot.Client.SetDebug(true)
 	go bot.Run()
 	s.SendBotGroupInvite()
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, slacktest.MessageWithText("thanks for the invite"))
+	assert.NoError(t, err, "bot did not respond in time")
 	seenMessages := s.GetSeenOutboundMessages()
 	if !assert.Len(t, seenMessages, 2, "should only have two messages") {
 		t.FailNow()
@@ -0,0 +1,139 @@
+package slacktest
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Fault is the failure returned instead of calling a Web API method
+type Fault struct {
+	// SlackError is returned as `{"ok":false,"error":"<SlackError>"}` such as `channel_not_found`
+	SlackError string
+	// Status is the HTTP status code of the response and defaults to 200.
+	// With no SlackError the response is a plain text HTTP error
+	Status int
+}
+
+// FaultPredicate reports whether a call to `method` with `params` should fail.
+// It may call FailNext or ClearFaults itself
+type FaultPredicate func(method string, params url.Values) bool
+
+type faultRule struct {
+	method string
+	match  FaultPredicate
+	// remaining is the number of calls left to fail or -1 to fail every call
+	remaining int
+	fault     Fault
+}
+
+type serverFaults struct {
+	sync.Mutex
+	rules []*faultRule
+}
+
+func (sf *serverFaults) add(r *faultRule) {
+	sf.Lock()
+	sf.rules = append(sf.rules, r)
+	sf.Unlock()
+}
+
+func (sf *serverFaults) clear() {
+	sf.Lock()
+	sf.rules = nil
+	sf.Unlock()
+}
+
+// take returns the fault for a call, using up one of the calls a rule fails.
+// Predicates are called without holding the lock so they can add or clear faults themselves
+func (sf *serverFaults) take(method string, params url.Values) (Fault, bool) {
+	sf.Lock()
+	rules := append([]*faultRule(nil), sf.rules...)
+	sf.Unlock()
+	for _, r := range rules {
+		if r.method != "" && r.method != method {
+			continue
+		}
+		if r.match != nil && !r.match(method, params) {
+			continue
+		}
+		if f, ok := sf.use(r); ok {
+			return f, true
+		}
+	}
+	return Fault{}, false
+}
+
+// use returns the fault of `r` and uses up one of its calls, unless it was cleared or used up in the meantime
+func (sf *serverFaults) use(r *faultRule) (Fault, bool) {
+	sf.Lock()
+	defer sf.Unlock()
+	for i, current := range sf.rules {
+		if current != r {
+			continue
+		}
+		if r.remaining > 0 {
+			r.remaining--
+			if r.remaining == 0 {
+				sf.rules = append(sf.rules[:i], sf.rules[i+1:]...)
+			}
+		}
+		return r.fault, true
+	}
+	return Fault{}, false
+}
+
+// write writes the fault as the response
+func (f Fault) write(w http.ResponseWriter) {
+	status := f.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if f.SlackError == "" {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeSlackError(w, f.SlackError)
+}
+
+// faultHandler returns injected faults instead of calling `next`.
+// The websocket endpoint and file downloads are not Web API methods and are never failed
+func faultHandler(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		params, err := journalParams(r)
+		if err != nil {
+			log.Printf("Unable to parse params for faults: %s", err.Error())
+		}
+		if f, ok := s.faults.take(apiMethod(r), params); ok {
+			f.write(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// FailNext fails the next `n` calls to `method` with `f`.
+// An empty `method` fails calls to any method
+func (sts *Server) FailNext(method string, n int, f Fault) {
+	if n <= 0 {
+		return
+	}
+	sts.faults.add(&faultRule{method: method, remaining: n, fault: f})
+}
+
+// FailWhen fails every call matching `match` with `f` until ClearFaults is called
+func (sts *Server) FailWhen(match FaultPredicate, f Fault) {
+	sts.faults.add(&faultRule{match: match, remaining: -1, fault: f})
+}
+
+// ClearFaults removes every injected fault
+func (sts *Server) ClearFaults() {
+	sts.faults.clear()
+}
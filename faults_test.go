@@ -0,0 +1,99 @@
+package slacktest
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailNext(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	s.FailNext("chat.postMessage", 2, Fault{SlackError: "channel_not_found"})
+	_, _, err := client.PostMessage("C024BE91L", "first", slack.PostMessageParameters{})
+	assert.EqualError(t, err, "channel_not_found")
+	_, err = client.GetUserInfo("W012A3CDE")
+	assert.NoError(t, err, "other methods should not fail")
+	_, _, err = client.PostMessage("C024BE91L", "second", slack.PostMessageParameters{})
+	assert.EqualError(t, err, "channel_not_found")
+	_, _, err = client.PostMessage("C024BE91L", "third", slack.PostMessageParameters{})
+	assert.NoError(t, err, "only the next two calls should fail")
+	assert.Len(t, s.APICalls("chat.postMessage"), 3, "failed calls should be journaled")
+	s.Stop()
+}
+
+func TestFailWhen(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	s.FailWhen(func(method string, params url.Values) bool {
+		return params.Get("channel") == "C024BE92L"
+	}, Fault{SlackError: "is_archived"})
+	_, _, err := client.PostMessage("C024BE92L", "archived", slack.PostMessageParameters{})
+	assert.EqualError(t, err, "is_archived")
+	_, err = client.GetChannelInfo("C024BE92L")
+	assert.EqualError(t, err, "is_archived")
+	_, _, err = client.PostMessage("C024BE91L", "fine", slack.PostMessageParameters{})
+	assert.NoError(t, err)
+	s.ClearFaults()
+	_, _, err = client.PostMessage("C024BE92L", "not archived anymore", slack.PostMessageParameters{})
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestFaultPredicateCanChangeFaults(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	s.FailWhen(func(method string, params url.Values) bool {
+		switch params.Get("text") {
+		case "fail the next lookup":
+			s.FailNext("users.info", 1, Fault{SlackError: "user_not_found"})
+			return true
+		case "stop failing":
+			s.ClearFaults()
+		}
+		return false
+	}, Fault{SlackError: "is_archived"})
+	_, _, err := client.PostMessage("C024BE91L", "fail the next lookup", slack.PostMessageParameters{})
+	assert.EqualError(t, err, "is_archived")
+	_, err = client.GetUserInfo("W012A3CDE")
+	assert.EqualError(t, err, "user_not_found")
+	_, _, err = client.PostMessage("C024BE91L", "stop failing", slack.PostMessageParameters{})
+	assert.NoError(t, err)
+	_, _, err = client.PostMessage("C024BE91L", "fail the next lookup", slack.PostMessageParameters{})
+	assert.NoError(t, err, "the faults were cleared")
+	s.Stop()
+}
+
+func TestFailNextHTTPStatus(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.FailNext("", 1, Fault{Status: http.StatusServiceUnavailable})
+	resp, err := http.PostForm(s.GetAPIURL()+"users.list", url.Values{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+	s.FailNext("users.list", 1, Fault{Status: http.StatusUnauthorized, SlackError: "invalid_auth"})
+	resp, err = http.PostForm(s.GetAPIURL()+"users.list", url.Values{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+	last, _ := s.LastAPICall("users.list")
+	assert.JSONEq(t, `{"ok":false,"error":"invalid_auth"}`, last.Response)
+	resp, err = http.PostForm(s.GetAPIURL()+"users.list", url.Values{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+	s.Stop()
+}
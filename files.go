@@ -0,0 +1,271 @@
+package slacktest
+
+import (
+	"bytes"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	slack "github.com/nlopes/slack"
+)
+
+// filesPath is where the server serves the content of uploaded files
+const filesPath = "/files/"
+
+// fileTypeCategories are the file types files.list can filter by
+var fileTypeCategories = map[string]func(slack.File) bool{
+	"spaces":   func(f slack.File) bool { return f.Filetype == "space" || f.Filetype == "post" },
+	"snippets": func(f slack.File) bool { return f.Mode == "snippet" },
+	"images":   func(f slack.File) bool { return strings.HasPrefix(f.Mimetype, "image/") },
+	"gdocs":    func(f slack.File) bool { return f.Filetype == "gdoc" },
+	"zips":     func(f slack.File) bool { return f.Filetype == "zip" },
+	"pdfs":     func(f slack.File) bool { return f.Filetype == "pdf" },
+}
+
+type storedFile struct {
+	file    slack.File
+	content []byte
+}
+
+type serverFiles struct {
+	sync.RWMutex
+	files []*storedFile
+}
+
+// copyFile returns a copy of `f` that doesn't share its slices with the original
+func copyFile(f slack.File) slack.File {
+	f.Channels = append([]string(nil), f.Channels...)
+	f.Groups = append([]string(nil), f.Groups...)
+	f.IMs = append([]string(nil), f.IMs...)
+	return f
+}
+
+// add stores `f` or replaces the file with the same id
+func (sf *serverFiles) add(f slack.File, content []byte) {
+	sf.Lock()
+	defer sf.Unlock()
+	stored := &storedFile{file: copyFile(f), content: append([]byte(nil), content...)}
+	for i, existing := range sf.files {
+		if existing.file.ID == f.ID {
+			sf.files[i] = stored
+			return
+		}
+	}
+	sf.files = append(sf.files, stored)
+}
+
+func (sf *serverFiles) get(id string) (slack.File, []byte, bool) {
+	sf.RLock()
+	defer sf.RUnlock()
+	for _, stored := range sf.files {
+		if stored.file.ID == id {
+			return copyFile(stored.file), append([]byte(nil), stored.content...), true
+		}
+	}
+	return slack.File{}, nil, false
+}
+
+func (sf *serverFiles) all() []slack.File {
+	sf.RLock()
+	defer sf.RUnlock()
+	files := make([]slack.File, len(sf.files))
+	for i, stored := range sf.files {
+		files[i] = copyFile(stored.file)
+	}
+	return files
+}
+
+// update calls `f` with the file `id` and reports whether it was found
+func (sf *serverFiles) update(id string, f func(*slack.File)) bool {
+	sf.Lock()
+	defer sf.Unlock()
+	for _, stored := range sf.files {
+		if stored.file.ID == id {
+			f(&stored.file)
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes the file `id` if `allow` accepts it and returns it
+func (sf *serverFiles) remove(id string, allow func(slack.File) bool) (slack.File, bool) {
+	sf.Lock()
+	defer sf.Unlock()
+	for i, stored := range sf.files {
+		if stored.file.ID != id {
+			continue
+		}
+		if !allow(stored.file) {
+			return stored.file, false
+		}
+		sf.files = append(sf.files[:i], sf.files[i+1:]...)
+		return stored.file, true
+	}
+	return slack.File{}, false
+}
+
+// fileSharedIn reports whether `f` has been shared in `channel`
+func fileSharedIn(f slack.File, channel string) bool {
+	return hasMember(f.Channels, channel) || hasMember(f.Groups, channel) || hasMember(f.IMs, channel)
+}
+
+// fileMatchesTypes reports whether `f` is one of the comma separated file `types` such as `images,pdfs`
+func fileMatchesTypes(f slack.File, types string) bool {
+	if types == "" || types == "all" {
+		return true
+	}
+	for _, t := range strings.Split(types, ",") {
+		if match, ok := fileTypeCategories[strings.TrimSpace(t)]; ok && match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// newFile describes `content` uploaded by `user` as `name`. Snippets are uploaded as text rather than a file
+func newFile(user, name, filetype string, content []byte, snippet bool) slack.File {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	if filetype == "" || filetype == "auto" {
+		filetype = ext
+	}
+	f := slack.File{
+		ID:       newID("F"),
+		Name:     name,
+		Title:    name,
+		Filetype: filetype,
+		User:     user,
+		Size:     len(content),
+		Mode:     "hosted",
+		Mimetype: mime.TypeByExtension("." + ext),
+	}
+	if snippet {
+		f.Mode = "snippet"
+		f.Editable = true
+		f.Lines = bytes.Count(content, []byte("\n")) + 1
+		if f.Filetype == "" {
+			f.Filetype = "text"
+		}
+		if f.Mimetype == "" {
+			f.Mimetype = "text/plain"
+		}
+	}
+	if f.Filetype == "" {
+		f.Filetype = "binary"
+	}
+	if f.Mimetype == "" {
+		f.Mimetype = "application/octet-stream"
+	}
+	f.PrettyType = strings.ToUpper(f.Filetype)
+	if f.Filetype == "text" {
+		f.PrettyType = "Plain Text"
+	}
+	now := slack.JSONTime(time.Now().Unix())
+	f.Created = now
+	f.Timestamp = now
+	return f
+}
+
+// fileURL returns where the server serves the content of `f`
+func (sts *Server) fileURL(f slack.File) string {
+	return "http://" + sts.ServerAddr + filesPath + f.ID + "/" + url.PathEscape(f.Name)
+}
+
+// shareFile adds the channels `f` is shared in by conversation type.
+// It returns the channels `f` wasn't already shared in
+func shareFile(f *slack.File, channels []string) []string {
+	var shared []string
+	for _, c := range channels {
+		if c == "" || fileSharedIn(*f, c) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(c, "G"):
+			f.Groups = append(f.Groups, c)
+		case strings.HasPrefix(c, "D"):
+			f.IMs = append(f.IMs, c)
+		default:
+			f.Channels = append(f.Channels, c)
+		}
+		shared = append(shared, c)
+	}
+	return shared
+}
+
+// uploadFile stores `f` shared in `channels` and notifies connected clients.
+// `source` is recorded against the resulting events
+func (sts *Server) uploadFile(f slack.File, content []byte, channels []string, source string) slack.File {
+	f.URLPrivate = sts.fileURL(f)
+	f.URLPrivateDownload = f.URLPrivate + "?download=1"
+	f.Permalink = f.URLPrivate
+	shared := shareFile(&f, channels)
+	sts.files.add(f, content)
+	queueEventForWebsocket(fileEvent{
+		Type:           "file_created",
+		FileID:         f.ID,
+		File:           fileRef{ID: f.ID},
+		UserID:         f.User,
+		EventTimestamp: newTimestamp(),
+	}, sts.ServerAddr, source)
+	for _, c := range shared {
+		queueEventForWebsocket(fileEvent{
+			Type:           "file_shared",
+			FileID:         f.ID,
+			File:           fileRef{ID: f.ID},
+			UserID:         f.User,
+			ChannelID:      c,
+			EventTimestamp: newTimestamp(),
+		}, sts.ServerAddr, source)
+	}
+	return f
+}
+
+// AddFile adds a fake file with `content` or replaces the one with the same id.
+// The file is given an id if it doesn't have one and its urls point at the server
+func (sts *Server) AddFile(f slack.File, content []byte) slack.File {
+	if f.ID == "" {
+		f.ID = newID("F")
+	}
+	f.Size = len(content)
+	f.URLPrivate = sts.fileURL(f)
+	f.URLPrivateDownload = f.URLPrivate + "?download=1"
+	f.Permalink = f.URLPrivate
+	sts.files.add(f, content)
+	return f
+}
+
+// GetFiles returns every uploaded or fake file, oldest first
+func (sts *Server) GetFiles() []slack.File {
+	return sts.files.all()
+}
+
+// GetFile returns the file with the given id
+func (sts *Server) GetFile(id string) (slack.File, error) {
+	f, _, ok := sts.files.get(id)
+	if !ok {
+		return slack.File{}, ErrFileNotFound
+	}
+	return f, nil
+}
+
+// GetFileContent returns the bytes uploaded for the file with the given id
+func (sts *Server) GetFileContent(id string) ([]byte, error) {
+	_, content, ok := sts.files.get(id)
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	return content, nil
+}
+
+// BotUploadedFile checks if the bot uploaded a file named `name` to `channel`
+func (sts *Server) BotUploadedFile(channel, name string) bool {
+	for _, f := range sts.files.all() {
+		if f.User == sts.BotID && f.Name == name && fileSharedIn(f, channel) {
+			return true
+		}
+	}
+	return false
+}
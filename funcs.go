@@ -2,54 +2,117 @@ package slacktest
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	websocket "github.com/gorilla/websocket"
 	slack "github.com/nlopes/slack"
 )
 
-func queueForWebsocket(s, hubname string) {
+var idCounter uint64
+
+var tsLock sync.Mutex
+var lastTimestamp time.Time
+
+// queueForWebsocket records `s` and queues it for connected clients without blocking.
+// `source` is the Web API method that caused it or SourceServer
+func queueForWebsocket(s, hubname, source string) error {
 	channel, err := getHubForServer(hubname)
 	if err != nil {
 		log.Printf("Unable to get server's channels: %s", err.Error())
+		return err
 	}
-	seenOutboundMessages.Lock()
-	seenOutboundMessages.messages = append(seenOutboundMessages.messages, s)
-	seenOutboundMessages.Unlock()
-	channel.sent <- s
-
+	e := newRecordedEvent(DirectionOutbound, source, s)
+	if qErr := channel.outbound.enqueue(e, channel.seenOutbound); qErr != nil {
+		log.Printf("Unable to queue event for websocket: %s", qErr.Error())
+		return qErr
+	}
+	return nil
 }
 
-func handlePendingMessages(c *websocket.Conn, hubname string) {
-	channel, err := getHubForServer(hubname)
+// queueEventForWebsocket marshals `evt` and queues it for connected clients
+func queueEventForWebsocket(evt interface{}, hubname, source string) {
+	j, err := json.Marshal(evt)
 	if err != nil {
-		log.Printf("Unable to get server's channels: %s", err.Error())
+		log.Printf("Unable to marshal event for websocket: %s", err.Error())
 		return
 	}
-	for m := range channel.sent {
-		err := c.WriteMessage(websocket.TextMessage, []byte(m))
-		if err != nil {
-			log.Printf("error writing message to websocket: %s", err.Error())
-			continue
+	_ = queueForWebsocket(string(j), hubname, source)
+}
+
+// handlePendingMessages writes the messages delivered to `rc` in order, delaying each
+// by the outbound latency in `latencies` if any, until the connection is closed
+func handlePendingMessages(rc *rtmConnection, latencies *serverLatencies) {
+	for {
+		select {
+		case <-rc.done:
+			return
+		case e := <-rc.outbound:
+			latencies.forDirection(DirectionOutbound).delay()
+			err := rc.write(websocket.TextMessage, []byte(e.Raw))
+			atomic.AddInt64(&rc.pending, -1)
+			if err != nil {
+				log.Printf("error writing message to websocket: %s", err.Error())
+				continue
+			}
 		}
 	}
 }
 
+// recordInbound records the websocket event `m` sent by a client authenticated as `user`
+func (sts *Server) recordInbound(m, user string) {
+	e := newRecordedEvent(DirectionInbound, SourceRTM, m)
+	e.User = user
+	sts.seenInboundMessages.add(e)
+}
+
 func postProcessMessage(m, hubname string) {
 	channel, err := getHubForServer(hubname)
 	if err != nil {
 		log.Printf("Unable to get server's channels: %s", err.Error())
 		return
 	}
-	seenInboundMessages.Lock()
-	seenInboundMessages.messages = append(seenInboundMessages.messages, m)
-	seenInboundMessages.Unlock()
 	// send to firehose
 	channel.seen <- m
 }
 
+func newMessageCollection() *messageCollection {
+	return &messageCollection{
+		changed: make(chan struct{}),
+	}
+}
+
+func (mc *messageCollection) add(m RecordedEvent) {
+	mc.Lock()
+	mc.messages = append(mc.messages, m)
+	close(mc.changed)
+	mc.changed = make(chan struct{})
+	mc.Unlock()
+}
+
+// all returns the raw json of the collected messages
+func (mc *messageCollection) all() []string {
+	mc.RLock()
+	defer mc.RUnlock()
+	m := make([]string, len(mc.messages))
+	for i, e := range mc.messages {
+		m[i] = e.Raw
+	}
+	return m
+}
+
+// hasMessageText checks if any collected event has the text `msg`
+func (mc *messageCollection) hasMessageText(msg string) bool {
+	return len(mc.events([]EventFilter{EventWithText(msg)})) > 0
+}
+
 func newHub() *hub {
 	h := &hub{}
 	c := make(map[string]*messageChannels)
@@ -80,6 +143,64 @@ func getHubForServer(serverAddr string) (*messageChannels, error) {
 	return channels, nil
 }
 
+// serverFromContext returns the Server handling the current request
+func serverFromContext(ctx context.Context) (*Server, error) {
+	s, ok := ctx.Value(serverContextKey).(*Server)
+	if !ok {
+		return nil, ErrNoServerInContext
+	}
+	return s, nil
+}
+
+// newID returns a new unique slack style id such as `C00000001`
+func newID(prefix string) string {
+	return fmt.Sprintf("%s%08d", prefix, atomic.AddUint64(&idCounter, 1))
+}
+
+// newTimestamp returns a new unique slack style message timestamp such as `1503435956.000247`
+func newTimestamp() string {
+	tsLock.Lock()
+	defer tsLock.Unlock()
+	now := time.Now()
+	if !now.After(lastTimestamp) {
+		now = lastTimestamp.Add(time.Microsecond)
+	}
+	lastTimestamp = now
+	return fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+}
+
+// timestampTime returns the time a message timestamp such as `1503435956.000247` refers to
+func timestampTime(ts string) (time.Time, bool) {
+	parts := strings.SplitN(ts, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var nsec int64
+	if len(parts) == 2 {
+		// the fraction is a decimal so `.5` is half a second
+		fraction := parts[1]
+		if len(fraction) > 9 {
+			return time.Time{}, false
+		}
+		nsec, err = strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+	}
+	return time.Unix(sec, nsec), true
+}
+
+// timestampBefore reports whether the message timestamp `a` is before `b`. Invalid timestamps come first
+func timestampBefore(a, b string) bool {
+	at, aOK := timestampTime(a)
+	bt, bOK := timestampTime(b)
+	if !aOK || !bOK {
+		return !aOK && bOK
+	}
+	return at.Before(bt)
+}
+
 // BotNameFromContext returns the botname from a provided context
 func BotNameFromContext(ctx context.Context) string {
 	botname, ok := ctx.Value(ServerBotNameContextKey).(string)
@@ -98,18 +219,85 @@ func BotIDFromContext(ctx context.Context) string {
 	return botname
 }
 
+// TeamFromContext returns the team from a provided context
+func TeamFromContext(ctx context.Context) *slack.Team {
+	team, ok := ctx.Value(ServerTeamContextKey).(*slack.Team)
+	if !ok {
+		return defaultTeam
+	}
+	return team
+}
+
+// DefaultUserFromContext returns the default human user from a provided context
+func DefaultUserFromContext(ctx context.Context) slack.User {
+	user, ok := ctx.Value(ServerDefaultUserContextKey).(slack.User)
+	if !ok {
+		return newDefaultNonBotUser()
+	}
+	return user
+}
+
+// ChannelsFromContext returns the channels from a provided context
+func ChannelsFromContext(ctx context.Context) []slack.Channel {
+	channels, ok := ctx.Value(ServerBotChannelsContextKey).([]slack.Channel)
+	if !ok {
+		return newDefaultChannels()
+	}
+	return channels
+}
+
+// GroupsFromContext returns the groups from a provided context
+func GroupsFromContext(ctx context.Context) []slack.Group {
+	groups, ok := ctx.Value(ServerBotGroupsContextKey).([]slack.Group)
+	if !ok {
+		return newDefaultGroups()
+	}
+	return groups
+}
+
+// UsersFromContext returns the users from a provided context
+func UsersFromContext(ctx context.Context) []slack.User {
+	users, ok := ctx.Value(ServerUsersContextKey).([]slack.User)
+	if !ok {
+		return []slack.User{DefaultUserFromContext(ctx), newBotUser(BotIDFromContext(ctx), BotNameFromContext(ctx))}
+	}
+	return users
+}
+
+// encodeCursor returns an opaque pagination cursor pointing at `id` in the same format slack uses
+func encodeCursor(kind, id string) string {
+	return base64.StdEncoding.EncodeToString([]byte(kind + ":" + id))
+}
+
+// decodeCursor returns the id a pagination cursor created by encodeCursor points at
+func decodeCursor(kind, cursor string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 || parts[0] != kind {
+		return "", ErrInvalidCursor
+	}
+	return parts[1], nil
+}
+
 // generate a full rtminfo response for initial rtm connections
 func generateRTMInfo(ctx context.Context, wsurl string) *fullInfoSlackResponse {
 	rtmInfo := slack.Info{
-		URL:  wsurl,
-		Team: defaultTeam,
-		User: defaultBotInfo,
+		URL:      wsurl,
+		Team:     TeamFromContext(ctx),
+		User:     &slack.UserDetails{},
+		Users:    UsersFromContext(ctx),
+		Channels: ChannelsFromContext(ctx),
+		Groups:   GroupsFromContext(ctx),
 	}
+	*rtmInfo.User = *defaultBotInfo
 	rtmInfo.User.ID = BotIDFromContext(ctx)
 	rtmInfo.User.Name = BotNameFromContext(ctx)
 	return &fullInfoSlackResponse{
-		rtmInfo,
-		okWebResponse,
+		Info:        rtmInfo,
+		WebResponse: okWebResponse,
 	}
 }
 
@@ -3,7 +3,9 @@ package slacktest
 import (
 	"context"
 	"testing"
+	"time"
 
+	slack "github.com/nlopes/slack"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,10 +37,33 @@ func TestCustomDefaultRTMInfo(t *testing.T) {
 	assert.Equal(t, defaultTeamDomain, info.Team.Domain)
 }
 
+func TestRTMInfoChannelsFromContext(t *testing.T) {
+	wsurl := "ws://127.0.0.1:5555/ws"
+	c := slack.Channel{}
+	c.ID = "C1234567890"
+	ctx := context.WithValue(context.TODO(), ServerBotChannelsContextKey, []slack.Channel{c})
+	info := generateRTMInfo(ctx, wsurl)
+	if !assert.Len(t, info.Channels, 1) {
+		t.FailNow()
+	}
+	assert.Equal(t, "C1234567890", info.Channels[0].ID)
+	assert.Len(t, info.Groups, 1, "should have the default group")
+}
+
+func TestTeamAndUserFromContext(t *testing.T) {
+	ctx := context.TODO()
+	assert.Equal(t, defaultTeamID, TeamFromContext(ctx).ID)
+	assert.Equal(t, defaultNonBotUserID, DefaultUserFromContext(ctx).ID)
+	ctx = context.WithValue(ctx, ServerTeamContextKey, &slack.Team{ID: "T1234567890"})
+	ctx = context.WithValue(ctx, ServerDefaultUserContextKey, slack.User{ID: "W999999"})
+	assert.Equal(t, "T1234567890", TeamFromContext(ctx).ID)
+	assert.Equal(t, "W999999", DefaultUserFromContext(ctx).ID)
+}
+
 func TestGetHubMissingServerAddr(t *testing.T) {
 	mc, err := getHubForServer("")
 	assert.Nil(t, mc.seen, "seen should be nil")
-	assert.Nil(t, mc.sent, "sent should be nil")
+	assert.Nil(t, mc.outbound, "outbound should be nil")
 	assert.Nil(t, mc.posted, "posted should be nil")
 	assert.Error(t, err, "should return an error")
 	assert.EqualError(t, err, ErrPassedEmptyServerAddr.Error())
@@ -47,7 +72,7 @@ func TestGetHubMissingServerAddr(t *testing.T) {
 func TestGetHubNoQueuesForServer(t *testing.T) {
 	mc, err := getHubForServer("foo")
 	assert.Nil(t, mc.seen, "seen should be nil")
-	assert.Nil(t, mc.sent, "sent should be nil")
+	assert.Nil(t, mc.outbound, "outbound should be nil")
 	assert.Nil(t, mc.posted, "posted should be nil")
 	assert.Error(t, err, "should return an error")
 	assert.EqualError(t, err, ErrNoQueuesRegisteredForServer.Error())
@@ -58,3 +83,14 @@ func TestUnableToAddToHub(t *testing.T) {
 	assert.Error(t, err, "should return and error")
 	assert.EqualError(t, err, ErrEmptyServerToHub.Error())
 }
+
+func TestTimestampTime(t *testing.T) {
+	at, ok := timestampTime("1503435956.000247")
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1503435956, 247000), at)
+	at, ok = timestampTime("1503435956.5")
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1503435956, 500000000), at, "the fraction is a decimal")
+	_, ok = timestampTime("not a ts")
+	assert.False(t, ok)
+}
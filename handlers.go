@@ -8,7 +8,8 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"time"
+	"strconv"
+	"strings"
 
 	websocket "github.com/gorilla/websocket"
 	slack "github.com/nlopes/slack"
@@ -19,29 +20,302 @@ func contextHandler(server *Server, next http.HandlerFunc) http.Handler {
 		ctx := context.WithValue(r.Context(), ServerURLContextKey, server.GetAPIURL())
 		ctx = context.WithValue(ctx, ServerWSContextKey, server.GetWSURL())
 		ctx = context.WithValue(ctx, ServerBotNameContextKey, server.BotName)
+		ctx = context.WithValue(ctx, ServerBotIDContextKey, server.BotID)
+		ctx = context.WithValue(ctx, ServerTeamContextKey, server.GetTeam())
+		ctx = context.WithValue(ctx, ServerDefaultUserContextKey, server.defaultUser)
 		ctx = context.WithValue(ctx, ServerBotChannelsContextKey, server.GetChannels())
 		ctx = context.WithValue(ctx, ServerBotGroupsContextKey, server.GetGroups())
+		ctx = context.WithValue(ctx, ServerUsersContextKey, server.GetUsers())
 		ctx = context.WithValue(ctx, ServerBotHubNameContextKey, server.ServerAddr)
+		ctx = context.WithValue(ctx, serverContextKey, server)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// parseRequestValues returns the form values of a request whether they
+// were passed in the query string or in an urlencoded body
+func parseRequestValues(r *http.Request) (url.Values, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return r.Form, nil
+}
+
+// apiMethod returns the Web API method a request was made to such as `chat.postMessage`
+func apiMethod(r *http.Request) string {
+	return strings.Trim(r.URL.Path, "/")
+}
+
+// isAPIRequest reports whether `r` is a Web API call rather than the websocket or a file download
+func isAPIRequest(r *http.Request) bool {
+	return r.URL.Path != "/ws" && !strings.HasPrefix(r.URL.Path, filesPath)
+}
+
+// writeJSON marshals `v` and writes it as the response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	j, jErr := json.Marshal(v)
+	if jErr != nil {
+		msg := fmt.Sprintf("Unable to marshal response: %s", jErr.Error())
+		log.Printf("Error: %s", msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(j)
+}
+
+// writeSlackError writes a slack api error response such as `{"ok":false,"error":"channel_not_found"}`
+func writeSlackError(w http.ResponseWriter, slackErr string) {
+	e := slack.WebError(slackErr)
+	writeJSON(w, slack.WebResponse{Ok: false, Error: &e})
+}
+
+// handle users.info
 func usersInfoHandler(w http.ResponseWriter, r *http.Request) {
-	_, _ = w.Write([]byte(defaultUsersInfoJSON))
+	values, err := parseRequestValues(r)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request: %s", err.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	u, ok := findUser(UsersFromContext(r.Context()), values.Get("user"))
+	if !ok {
+		writeSlackError(w, "user_not_found")
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		User slack.User `json:"user"`
+	}{
+		WebResponse: okWebResponse,
+		User:        u,
+	}
+	writeJSON(w, resp)
+}
+
+// handle users.list
+func usersListHandler(w http.ResponseWriter, r *http.Request) {
+	values, err := parseRequestValues(r)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request: %s", err.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	users := UsersFromContext(r.Context())
+	// without a limit, or with `limit=0`, every user is returned on one page
+	limit := len(users)
+	if l := values.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			writeSlackError(w, "invalid_limit")
+			return
+		}
+	}
+	start := 0
+	if c := values.Get("cursor"); c != "" {
+		id, cErr := decodeCursor("user", c)
+		if cErr != nil {
+			writeSlackError(w, "invalid_cursor")
+			return
+		}
+		start = -1
+		for i, u := range users {
+			if u.ID == id {
+				start = i
+				break
+			}
+		}
+		if start == -1 {
+			writeSlackError(w, "invalid_cursor")
+			return
+		}
+	}
+	end := len(users)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	cursor := ""
+	if end < len(users) {
+		cursor = encodeCursor("user", users[end].ID)
+	}
+	resp := struct {
+		slack.WebResponse
+		Members          []slack.User     `json:"members"`
+		ResponseMetadata responseMetadata `json:"response_metadata"`
+	}{
+		WebResponse:      okWebResponse,
+		Members:          users[start:end],
+		ResponseMetadata: responseMetadata{NextCursor: cursor},
+	}
+	writeJSON(w, resp)
+}
+
+// handle users.getPresence
+func usersGetPresenceHandler(w http.ResponseWriter, r *http.Request) {
+	values, err := parseRequestValues(r)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request: %s", err.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	id := values.Get("user")
+	if id == "" {
+		id = BotIDFromContext(r.Context())
+	}
+	u, ok := findUser(UsersFromContext(r.Context()), id)
+	if !ok {
+		writeSlackError(w, "user_not_found")
+		return
+	}
+	presence := u.Presence
+	if presence == "" {
+		presence = "active"
+	}
+	resp := struct {
+		slack.WebResponse
+		slack.UserPresence
+	}{
+		WebResponse: okWebResponse,
+		UserPresence: slack.UserPresence{
+			Presence: presence,
+			Online:   presence == "active",
+		},
+	}
+	writeJSON(w, resp)
+}
+
+// handle users.profile.get
+func usersProfileGetHandler(w http.ResponseWriter, r *http.Request) {
+	values, err := parseRequestValues(r)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request: %s", err.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	id := values.Get("user")
+	if id == "" {
+		id = BotIDFromContext(r.Context())
+	}
+	u, ok := findUser(UsersFromContext(r.Context()), id)
+	if !ok {
+		writeSlackError(w, "user_not_found")
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		Profile slack.UserProfile `json:"profile"`
+	}{
+		WebResponse: okWebResponse,
+		Profile:     u.Profile,
+	}
+	writeJSON(w, resp)
 }
 
 func botsInfoHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(defaultBotInfoJSON(r.Context())))
 }
 
+// handle auth.test
+func authTestHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	team := TeamFromContext(r.Context())
+	user := s.tokenUser(requestToken(r, values))
+	name := s.BotName
+	if u, found := findUser(s.GetUsers(), user); found {
+		name = u.Name
+	}
+	resp := struct {
+		slack.WebResponse
+		slack.AuthTestResponse
+	}{
+		WebResponse: okWebResponse,
+		AuthTestResponse: slack.AuthTestResponse{
+			URL:    "https://" + team.Domain + ".slack.com/",
+			Team:   team.Name,
+			User:   name,
+			TeamID: team.ID,
+			UserID: user,
+		},
+	}
+	writeJSON(w, resp)
+}
+
 // handle channels.list
 func listChannelsHandler(w http.ResponseWriter, r *http.Request) {
-	_, _ = w.Write([]byte(defaultChannelsListJSON))
+	resp := struct {
+		slack.WebResponse
+		Channels []slack.Channel `json:"channels"`
+	}{
+		WebResponse: okWebResponse,
+		Channels:    ChannelsFromContext(r.Context()),
+	}
+	writeJSON(w, resp)
 }
 
 // handle groups.list
 func listGroupsHandler(w http.ResponseWriter, r *http.Request) {
-	_, _ = w.Write([]byte(defaultGroupsListJSON))
+	resp := struct {
+		slack.WebResponse
+		Groups []slack.Group `json:"groups"`
+	}{
+		WebResponse: okWebResponse,
+		Groups:      GroupsFromContext(r.Context()),
+	}
+	writeJSON(w, resp)
+}
+
+// handle channels.info
+func channelsInfoHandler(w http.ResponseWriter, r *http.Request) {
+	values, err := parseRequestValues(r)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request: %s", err.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	c, ok := findChannel(ChannelsFromContext(r.Context()), values.Get("channel"))
+	if !ok {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		Channel slack.Channel `json:"channel"`
+	}{
+		WebResponse: okWebResponse,
+		Channel:     c,
+	}
+	writeJSON(w, resp)
+}
+
+// handle groups.info
+func groupsInfoHandler(w http.ResponseWriter, r *http.Request) {
+	values, err := parseRequestValues(r)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request: %s", err.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	g, ok := findGroup(GroupsFromContext(r.Context()), values.Get("channel"))
+	if !ok {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		Group slack.Group `json:"group"`
+	}{
+		WebResponse: okWebResponse,
+		Group:       g,
+	}
+	writeJSON(w, resp)
 }
 
 // handle chat.postMessage
@@ -61,39 +335,40 @@ func postMessageHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
+	if s, sErr := serverFromContext(r.Context()); sErr == nil {
+		if slackErr := s.rejectPostMessage(values); slackErr != "" {
+			writeSlackError(w, slackErr)
+			return
+		}
+	}
 
-	ts := time.Now().Unix()
-	resp := fmt.Sprintf(`{"channel":"%s","ts":"%d", "text":"%s", "ok": true}`, values.Get("channel"), ts, values.Get("text"))
 	m := slack.Message{}
 	m.Type = "message"
 	m.Channel = values.Get("channel")
-	m.Timestamp = fmt.Sprintf("%d", ts)
+	m.Timestamp = newTimestamp()
 	m.Text = values.Get("text")
+	m.ThreadTimestamp = values.Get("thread_ts")
+	if m.ThreadTimestamp != "" && (values.Get("reply_broadcast") == "true" || values.Get("reply_broadcast") == "1") {
+		m.SubType = "thread_broadcast"
+	}
 	if values.Get("as_user") != "true" {
-		m.User = defaultNonBotUserID
-		m.Username = defaultNonBotUserName
+		user := DefaultUserFromContext(r.Context())
+		m.User = user.ID
+		m.Username = user.RealName
 	} else {
 		m.User = BotIDFromContext(r.Context())
 		m.Username = BotNameFromContext(r.Context())
 	}
-	attachments := values.Get("attachments")
-	if attachments != "" {
-		decoded, err := url.QueryUnescape(attachments)
-		if err != nil {
-			msg := fmt.Sprintf("Unable to decode attachments: %s", err.Error())
-			log.Printf(msg)
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
-		}
-		var attaches []slack.Attachment
-		aJErr := json.Unmarshal([]byte(decoded), &attaches)
-		if aJErr != nil {
-			msg := fmt.Sprintf("Unable to decode attachments string to json: %s", aJErr.Error())
-			log.Printf(msg)
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
-		}
-		m.Attachments = attaches
+	attaches, aErr := decodeAttachments(values)
+	if aErr != nil {
+		log.Print(aErr.Error())
+		http.Error(w, aErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.Attachments = attaches
+	var replied *messageChangedEvent
+	if s, sErr := serverFromContext(r.Context()); sErr == nil {
+		m, replied = s.recordMessage(m, s.tokenUser(requestToken(r, values)))
 	}
 	jsonMessage, jsonErr := json.Marshal(m)
 	if jsonErr != nil {
@@ -102,12 +377,44 @@ func postMessageHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
-	go queueForWebsocket(string(jsonMessage), serverAddr)
-	_, _ = w.Write([]byte(resp))
+	_ = queueForWebsocket(string(jsonMessage), serverAddr, apiMethod(r))
+	queueReplied(replied, serverAddr, apiMethod(r))
+	resp := struct {
+		slack.WebResponse
+		Channel string        `json:"channel"`
+		Ts      string        `json:"ts"`
+		Text    string        `json:"text"`
+		Message slack.Message `json:"message"`
+	}{
+		WebResponse: okWebResponse,
+		Channel:     m.Channel,
+		Ts:          m.Timestamp,
+		Text:        m.Text,
+		Message:     m,
+	}
+	writeJSON(w, resp)
+}
+
+// decodeAttachments returns the attachments passed to a chat method
+func decodeAttachments(values url.Values) ([]slack.Attachment, error) {
+	attachments := values.Get("attachments")
+	if attachments == "" {
+		return nil, nil
+	}
+	decoded, err := url.QueryUnescape(attachments)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode attachments: %s", err.Error())
+	}
+	var attaches []slack.Attachment
+	aJErr := json.Unmarshal([]byte(decoded), &attaches)
+	if aJErr != nil {
+		return nil, fmt.Errorf("Unable to decode attachments string to json: %s", aJErr.Error())
+	}
+	return attaches, nil
 }
 
 func rtmStartHandler(w http.ResponseWriter, r *http.Request) {
-	_, err := ioutil.ReadAll(r.Body)
+	values, err := parseRequestValues(r)
 	if err != nil {
 		msg := fmt.Sprintf("Error reading body: %s", err.Error())
 		log.Printf(msg)
@@ -123,6 +430,14 @@ func rtmStartHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fullresponse := generateRTMInfo(r.Context(), wsurl)
+	if s, sErr := serverFromContext(r.Context()); sErr == nil {
+		s.connections.issue()
+		s.authenticateRTM(&fullresponse.Info, values.Get("token"))
+		fullresponse.Info.IMs = s.ims.forUser(fullresponse.Info.User.ID)
+		if isTrue(values.Get("mpim_aware")) {
+			fullresponse.MPIMs = asMPIMs(s.mpims.forUser(fullresponse.Info.User.ID))
+		}
+	}
 	j, jErr := json.Marshal(fullresponse)
 	if jErr != nil {
 		msg := fmt.Sprintf("Unable to marshal response: %s", jErr.Error())
@@ -136,7 +451,37 @@ func rtmStartHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handle rtm.connect
+func rtmConnectHandler(w http.ResponseWriter, r *http.Request) {
+	wsurl := r.Context().Value(ServerWSContextKey).(string)
+	team := TeamFromContext(r.Context())
+	info := slack.Info{
+		URL: wsurl,
+		User: &slack.UserDetails{
+			ID:   BotIDFromContext(r.Context()),
+			Name: BotNameFromContext(r.Context()),
+		},
+		Team: team,
+	}
+	if s, sErr := serverFromContext(r.Context()); sErr == nil {
+		s.connections.issue()
+		values, _ := parseRequestValues(r)
+		s.authenticateRTM(&info, values.Get("token"))
+	}
+	writeJSON(w, fullInfoSlackResponse{Info: info, WebResponse: okWebResponse})
+}
+
 func wsHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := serverFromContext(r.Context())
+	if err != nil {
+		log.Print(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if s.connections.refusing() {
+		http.Error(w, "refusing websocket connections", http.StatusServiceUnavailable)
+		return
+	}
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
@@ -151,14 +496,25 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
-	defer func() { _ = c.Close() }()
+	if s.connections.park() {
+		go parkConnection(c)
+		return
+	}
+	rc := newRTMConnection(c, s.tokenUser(r.URL.Query().Get("token")))
+	rc.viaRTMStart = s.connections.claim()
+	s.connect(rc)
+	defer s.disconnect(rc, websocket.CloseNormalClosure, "")
 	serverAddr := r.Context().Value(ServerBotHubNameContextKey).(string)
-	go handlePendingMessages(c, serverAddr)
+	latencies := s.latencies
+	go handlePendingMessages(rc, latencies)
 	for {
 		mt, messageBytes, err := c.ReadMessage()
 		if err != nil {
-			log.Printf("read error: %s", err.Error())
-			continue
+			// reads on a failed websocket connection keep failing so the client has to reconnect
+			if !rc.closed() {
+				log.Printf("read error: %s", err.Error())
+			}
+			return
 		}
 		message := string(messageBytes)
 		evt := &slack.Event{}
@@ -180,14 +536,58 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 				Type:    "pong",
 			}
 			j, _ := json.Marshal(pong)
-			wErr := c.WriteMessage(mt, j)
+			wErr := rc.write(mt, j)
 			if wErr != nil {
 				log.Printf("error writing pong back to socket: %s", wErr.Error())
 				continue
 			}
 			continue
 		} else {
+			latencies.forDirection(DirectionInbound).delay()
+			rtmMsg := &slack.OutgoingMessage{}
+			if evt.Type == slack.TYPE_MESSAGE {
+				_ = json.Unmarshal(messageBytes, rtmMsg)
+				if reject := s.rejectRTMMessage(*rtmMsg, len(messageBytes)); reject != nil {
+					if wErr := rc.write(mt, reject); wErr != nil {
+						log.Printf("error writing error ack to socket: %s", wErr.Error())
+					}
+					continue
+				}
+			}
+			// recorded before any ack so the event can be found as soon as the client hears back
+			s.recordInbound(message, rc.user)
+			if evt.Type == "typing" {
+				if tErr := s.recordTyping(rc, messageBytes); tErr != nil {
+					log.Printf("Unable to decode typing event: %s", tErr.Error())
+				}
+			}
+			if evt.Type == slack.TYPE_MESSAGE {
+				m, replied, rErr := recordRTMMessage(r.Context(), messageBytes, rc.user)
+				if rErr != nil {
+					log.Printf("Unable to record rtm message: %s", rErr.Error())
+					continue
+				}
+				if wErr := rc.write(mt, rtmAck(rtmMsg.ID, m)); wErr != nil {
+					log.Printf("error writing ack to socket: %s", wErr.Error())
+				}
+				queueReplied(replied, serverAddr, SourceRTM)
+			}
 			go postProcessMessage(message, serverAddr)
 		}
 	}
 }
+
+// recordRTMMessage stores a message `user` sent over the websocket and returns it
+// along with the `message_replied` event to send once it's acknowledged, if any
+func recordRTMMessage(ctx context.Context, data []byte, user string) (slack.Message, *messageChangedEvent, error) {
+	s, err := serverFromContext(ctx)
+	if err != nil {
+		return slack.Message{}, nil, err
+	}
+	m, mErr := messageFromRTM(data, user)
+	if mErr != nil {
+		return slack.Message{}, nil, mErr
+	}
+	m, replied := s.recordMessage(m, m.User)
+	return m, replied, nil
+}
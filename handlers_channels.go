@@ -0,0 +1,505 @@
+package slacktest
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	slack "github.com/nlopes/slack"
+)
+
+const maxChannelNameLength = 21
+const maxTopicLength = 250
+
+// serverAndValues returns the Server and the request values for a handler
+// writing an error response if either can't be found
+func serverAndValues(w http.ResponseWriter, r *http.Request) (*Server, url.Values, bool) {
+	s, err := serverFromContext(r.Context())
+	if err != nil {
+		log.Print(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	values, err := parseRequestValues(r)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to decode request: %s", err.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return s, values, true
+}
+
+// validateChannelName returns the slack error for an invalid channel name
+func validateChannelName(name string) string {
+	if name == "" {
+		return "invalid_name_required"
+	}
+	if len(name) > maxChannelNameLength {
+		return "invalid_name_maxlength"
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return "invalid_name_specials"
+		}
+	}
+	return ""
+}
+
+func writeChannelResponse(w http.ResponseWriter, c slack.Channel) {
+	resp := struct {
+		slack.WebResponse
+		Channel slack.Channel `json:"channel"`
+	}{
+		WebResponse: okWebResponse,
+		Channel:     c,
+	}
+	writeJSON(w, resp)
+}
+
+// createChannel creates the public channel `name` with `creator` as its only member and notifies connected clients.
+// It reports whether the channel was created, which it isn't if the name is taken
+func (sts *Server) createChannel(name, creator, source string) (slack.Channel, bool) {
+	c := slack.Channel{}
+	c.ID = newID("C")
+	c.Name = name
+	c.IsChannel = true
+	c.IsMember = true
+	c.Created = nowAsJSONTime()
+	c.Creator = creator
+	c.Members = []string{creator}
+	if !sts.channels.create(c) {
+		return slack.Channel{}, false
+	}
+	queueEventForWebsocket(slack.ChannelCreatedEvent{
+		Type: "channel_created",
+		Channel: slack.ChannelCreatedInfo{
+			ID:        c.ID,
+			IsChannel: true,
+			Name:      c.Name,
+			Created:   int(c.Created),
+			Creator:   c.Creator,
+		},
+		EventTimestamp: newTimestamp(),
+	}, sts.ServerAddr, source)
+	return c, true
+}
+
+// joinChannel adds `user` to the channel `id` and notifies connected clients if they weren't already a member.
+// It reports whether `user` was already in the channel
+func (sts *Server) joinChannel(id, user, source string) (slack.Channel, bool) {
+	alreadyIn := false
+	var joined slack.Channel
+	sts.channels.update(id, func(c *slack.Channel) {
+		alreadyIn = hasMember(c.Members, user)
+		if !alreadyIn {
+			c.Members = append(c.Members, user)
+		}
+		c.IsMember = true
+		joined = copyChannel(*c)
+	})
+	if !alreadyIn {
+		queueEventForWebsocket(slack.ChannelJoinedEvent{
+			Type:    "channel_joined",
+			Channel: joined,
+		}, sts.ServerAddr, source)
+		queueEventForWebsocket(memberJoinedChannelEvent{
+			Type:        "member_joined_channel",
+			User:        user,
+			Channel:     joined.ID,
+			ChannelType: "C",
+			Team:        sts.GetTeam().ID,
+		}, sts.ServerAddr, source)
+	}
+	return joined, alreadyIn
+}
+
+// handle channels.create
+func channelsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(values.Get("name"), "#")
+	if slackErr := validateChannelName(name); slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	c, created := s.createChannel(name, BotIDFromContext(r.Context()), apiMethod(r))
+	if !created {
+		writeSlackError(w, "name_taken")
+		return
+	}
+	writeChannelResponse(w, c)
+}
+
+// handle channels.archive
+func channelsArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	slackErr := ""
+	found := s.channels.update(id, func(c *slack.Channel) {
+		switch {
+		case c.IsArchived:
+			slackErr = "already_archived"
+		case c.IsGeneral:
+			slackErr = "cant_archive_general"
+		default:
+			c.IsArchived = true
+		}
+	})
+	if !found {
+		slackErr = "channel_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	queueEventForWebsocket(slack.ChannelArchiveEvent{
+		Type:    "channel_archive",
+		Channel: id,
+		User:    BotIDFromContext(r.Context()),
+	}, s.ServerAddr, apiMethod(r))
+	writeJSON(w, okWebResponse)
+}
+
+// handle channels.unarchive
+func channelsUnarchiveHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	slackErr := ""
+	found := s.channels.update(id, func(c *slack.Channel) {
+		if !c.IsArchived {
+			slackErr = "not_archived"
+			return
+		}
+		c.IsArchived = false
+	})
+	if !found {
+		slackErr = "channel_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	queueEventForWebsocket(slack.ChannelUnarchiveEvent{
+		Type:    "channel_unarchive",
+		Channel: id,
+		User:    BotIDFromContext(r.Context()),
+	}, s.ServerAddr, apiMethod(r))
+	writeJSON(w, okWebResponse)
+}
+
+// handle channels.rename
+func channelsRenameHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	name := strings.TrimPrefix(values.Get("name"), "#")
+	if slackErr := validateChannelName(name); slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	if existing, taken := s.channels.byName(name); taken && existing.ID != id {
+		writeSlackError(w, "name_taken")
+		return
+	}
+	var renamed slack.Channel
+	found := s.channels.update(id, func(c *slack.Channel) {
+		c.Name = name
+		renamed = copyChannel(*c)
+	})
+	if !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	queueEventForWebsocket(slack.ChannelRenameEvent{
+		Type: "channel_rename",
+		Channel: slack.ChannelRenameInfo{
+			ID:      renamed.ID,
+			Name:    renamed.Name,
+			Created: fmt.Sprintf("%d", renamed.Created),
+		},
+		Timestamp: newTimestamp(),
+	}, s.ServerAddr, apiMethod(r))
+	writeChannelResponse(w, renamed)
+}
+
+// handle channels.invite
+func channelsInviteHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	userID := values.Get("user")
+	botID := BotIDFromContext(r.Context())
+	if _, userFound := findUser(s.GetUsers(), userID); !userFound {
+		writeSlackError(w, "user_not_found")
+		return
+	}
+	if userID == botID {
+		writeSlackError(w, "cant_invite_self")
+		return
+	}
+	slackErr := ""
+	var invited slack.Channel
+	found := s.channels.update(id, func(c *slack.Channel) {
+		switch {
+		case c.IsArchived:
+			slackErr = "is_archived"
+		case hasMember(c.Members, userID):
+			slackErr = "already_in_channel"
+		default:
+			c.Members = append(c.Members, userID)
+			invited = copyChannel(*c)
+		}
+	})
+	if !found {
+		slackErr = "channel_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	queueEventForWebsocket(memberJoinedChannelEvent{
+		Type:        "member_joined_channel",
+		User:        userID,
+		Channel:     id,
+		ChannelType: "C",
+		Team:        TeamFromContext(r.Context()).ID,
+		Inviter:     botID,
+	}, s.ServerAddr, apiMethod(r))
+	writeChannelResponse(w, invited)
+}
+
+// handle channels.kick
+func channelsKickHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	userID := values.Get("user")
+	botID := BotIDFromContext(r.Context())
+	if _, userFound := findUser(s.GetUsers(), userID); !userFound {
+		writeSlackError(w, "user_not_found")
+		return
+	}
+	if userID == botID {
+		writeSlackError(w, "cant_kick_self")
+		return
+	}
+	slackErr := ""
+	found := s.channels.update(id, func(c *slack.Channel) {
+		switch {
+		case c.IsGeneral:
+			slackErr = "cant_kick_from_general"
+		case !hasMember(c.Members, userID):
+			slackErr = "not_in_channel"
+		default:
+			c.Members = removeMember(c.Members, userID)
+		}
+	})
+	if !found {
+		slackErr = "channel_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	queueEventForWebsocket(memberLeftChannelEvent{
+		Type:        "member_left_channel",
+		User:        userID,
+		Channel:     id,
+		ChannelType: "C",
+		Team:        TeamFromContext(r.Context()).ID,
+	}, s.ServerAddr, apiMethod(r))
+	writeJSON(w, okWebResponse)
+}
+
+// handle channels.join
+func channelsJoinHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(values.Get("name"), "#")
+	if slackErr := validateChannelName(name); slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	botID := BotIDFromContext(r.Context())
+	existing, exists := s.channels.byName(name)
+	if !exists {
+		// joining a channel that doesn't exist creates it
+		channelsCreateHandler(w, r)
+		return
+	}
+	if existing.IsArchived {
+		writeSlackError(w, "is_archived")
+		return
+	}
+	joined, alreadyIn := s.joinChannel(existing.ID, botID, apiMethod(r))
+	resp := struct {
+		slack.WebResponse
+		AlreadyInChannel bool          `json:"already_in_channel,omitempty"`
+		Channel          slack.Channel `json:"channel"`
+	}{
+		WebResponse:      okWebResponse,
+		AlreadyInChannel: alreadyIn,
+		Channel:          joined,
+	}
+	writeJSON(w, resp)
+}
+
+// handle channels.leave
+func channelsLeaveHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	botID := BotIDFromContext(r.Context())
+	slackErr := ""
+	wasMember := false
+	found := s.channels.update(id, func(c *slack.Channel) {
+		switch {
+		case c.IsArchived:
+			slackErr = "is_archived"
+		case c.IsGeneral:
+			slackErr = "cant_leave_general"
+		default:
+			wasMember = hasMember(c.Members, botID)
+			c.Members = removeMember(c.Members, botID)
+			c.IsMember = false
+		}
+	})
+	if !found {
+		slackErr = "channel_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	if wasMember {
+		queueEventForWebsocket(slack.ChannelLeftEvent{
+			Type:    "channel_left",
+			Channel: id,
+		}, s.ServerAddr, apiMethod(r))
+	}
+	resp := struct {
+		slack.WebResponse
+		NotInChannel bool `json:"not_in_channel,omitempty"`
+	}{
+		WebResponse:  okWebResponse,
+		NotInChannel: !wasMember,
+	}
+	writeJSON(w, resp)
+}
+
+// handle channels.setTopic
+func channelsSetTopicHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	topic := values.Get("topic")
+	if len(topic) > maxTopicLength {
+		writeSlackError(w, "too_long")
+		return
+	}
+	botID := BotIDFromContext(r.Context())
+	slackErr := ""
+	found := s.channels.update(id, func(c *slack.Channel) {
+		if c.IsArchived {
+			slackErr = "is_archived"
+			return
+		}
+		c.Topic = slack.Topic{Value: topic, Creator: botID, LastSet: nowAsJSONTime()}
+	})
+	if !found {
+		slackErr = "channel_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	m := slack.Message{}
+	m.Type = slack.TYPE_MESSAGE
+	m.SubType = "channel_topic"
+	m.Channel = id
+	m.User = botID
+	m.Topic = topic
+	m.Text = fmt.Sprintf("<@%s|%s> set the channel topic: %s", botID, BotNameFromContext(r.Context()), topic)
+	m.Timestamp = newTimestamp()
+	m, _ = s.recordMessage(m, botID)
+	queueEventForWebsocket(m, s.ServerAddr, apiMethod(r))
+	resp := struct {
+		slack.WebResponse
+		Topic string `json:"topic"`
+	}{
+		WebResponse: okWebResponse,
+		Topic:       topic,
+	}
+	writeJSON(w, resp)
+}
+
+// handle channels.setPurpose
+func channelsSetPurposeHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	purpose := values.Get("purpose")
+	if len(purpose) > maxTopicLength {
+		writeSlackError(w, "too_long")
+		return
+	}
+	botID := BotIDFromContext(r.Context())
+	slackErr := ""
+	found := s.channels.update(id, func(c *slack.Channel) {
+		if c.IsArchived {
+			slackErr = "is_archived"
+			return
+		}
+		c.Purpose = slack.Purpose{Value: purpose, Creator: botID, LastSet: nowAsJSONTime()}
+	})
+	if !found {
+		slackErr = "channel_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	m := slack.Message{}
+	m.Type = slack.TYPE_MESSAGE
+	m.SubType = "channel_purpose"
+	m.Channel = id
+	m.User = botID
+	m.Purpose = purpose
+	m.Text = fmt.Sprintf("<@%s|%s> set the channel purpose: %s", botID, BotNameFromContext(r.Context()), purpose)
+	m.Timestamp = newTimestamp()
+	m, _ = s.recordMessage(m, botID)
+	queueEventForWebsocket(m, s.ServerAddr, apiMethod(r))
+	resp := struct {
+		slack.WebResponse
+		Purpose string `json:"purpose"`
+	}{
+		WebResponse: okWebResponse,
+		Purpose:     purpose,
+	}
+	writeJSON(w, resp)
+}
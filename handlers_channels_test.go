@@ -0,0 +1,150 @@
+package slacktest
+
+import (
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelsCreateHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channel, err := client.CreateChannel("ops")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "ops", channel.Name)
+	assert.Equal(t, s.BotID, channel.Creator)
+	assert.Equal(t, []string{s.BotID}, channel.Members)
+	info, err := client.GetChannelInfo(channel.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "ops", info.Name)
+	_, err = client.CreateChannel("ops")
+	assert.EqualError(t, err, "name_taken")
+	_, err = client.CreateChannel("Not A Name")
+	assert.EqualError(t, err, "invalid_name_specials")
+	assert.True(t, waitForOutboundType(s, "channel_created"), "should have sent channel_created")
+}
+
+func TestChannelsArchiveHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channel, err := client.CreateChannel("ops")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.NoError(t, client.ArchiveChannel(channel.ID))
+	assert.EqualError(t, client.ArchiveChannel(channel.ID), "already_archived")
+	assert.EqualError(t, client.ArchiveChannel("C024BE91L"), "cant_archive_general")
+	assert.EqualError(t, client.ArchiveChannel("C999999999"), "channel_not_found")
+	info, err := client.GetChannelInfo(channel.ID)
+	assert.NoError(t, err)
+	assert.True(t, info.IsArchived)
+	assert.True(t, waitForOutboundType(s, "channel_archive"), "should have sent channel_archive")
+	assert.NoError(t, client.UnarchiveChannel(channel.ID))
+	assert.EqualError(t, client.UnarchiveChannel(channel.ID), "not_archived")
+	assert.True(t, waitForOutboundType(s, "channel_unarchive"), "should have sent channel_unarchive")
+}
+
+func TestChannelsRenameHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channel, err := client.RenameChannel("C024BE92L", "playground")
+	assert.NoError(t, err)
+	assert.Equal(t, "playground", channel.Name)
+	_, err = client.RenameChannel("C024BE92L", "general")
+	assert.EqualError(t, err, "name_taken")
+	_, err = client.RenameChannel("C999999999", "foo")
+	assert.EqualError(t, err, "channel_not_found")
+	assert.True(t, waitForOutboundType(s, "channel_rename"), "should have sent channel_rename")
+}
+
+func TestChannelsInviteAndKickHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W999999", Name: "venkman"})
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channel, err := client.InviteUserToChannel("C024BE92L", "W999999")
+	assert.NoError(t, err)
+	assert.Contains(t, channel.Members, "W999999")
+	_, err = client.InviteUserToChannel("C024BE92L", "W999999")
+	assert.EqualError(t, err, "already_in_channel")
+	_, err = client.InviteUserToChannel("C024BE92L", "W000000")
+	assert.EqualError(t, err, "user_not_found")
+	assert.True(t, waitForOutboundType(s, "member_joined_channel"), "should have sent member_joined_channel")
+	assert.EqualError(t, client.KickUserFromChannel("C024BE92L", s.BotID), "cant_kick_self")
+	assert.EqualError(t, client.KickUserFromChannel("C024BE91L", "W999999"), "cant_kick_from_general")
+	c := slack.Channel{}
+	c.ID = "C1234567890"
+	c.Name = "ops"
+	c.Members = []string{"W999999"}
+	s.AddChannel(c)
+	assert.NoError(t, client.KickUserFromChannel("C1234567890", "W999999"))
+	assert.EqualError(t, client.KickUserFromChannel("C1234567890", "W999999"), "not_in_channel")
+	assert.True(t, waitForOutboundType(s, "member_left_channel"), "should have sent member_left_channel")
+}
+
+func TestChannelsJoinAndLeaveHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	c := slack.Channel{}
+	c.ID = "C1234567890"
+	c.Name = "ops"
+	s.AddChannel(c)
+	channel, err := client.JoinChannel("#ops")
+	assert.NoError(t, err)
+	assert.Equal(t, "C1234567890", channel.ID)
+	assert.Contains(t, channel.Members, s.BotID)
+	assert.True(t, waitForOutboundType(s, "channel_joined"), "should have sent channel_joined")
+	notIn, err := client.LeaveChannel("C1234567890")
+	assert.NoError(t, err)
+	assert.False(t, notIn)
+	assert.True(t, waitForOutboundType(s, "channel_left"), "should have sent channel_left")
+	notIn, err = client.LeaveChannel("C1234567890")
+	assert.NoError(t, err)
+	assert.True(t, notIn)
+	_, err = client.LeaveChannel("C024BE91L")
+	assert.EqualError(t, err, "cant_leave_general")
+	created, err := client.JoinChannel("brand-new")
+	assert.NoError(t, err)
+	assert.Equal(t, "brand-new", created.Name)
+}
+
+func TestChannelsSetTopicAndPurposeHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	topic, err := client.SetChannelTopic("C024BE92L", "a new topic")
+	assert.NoError(t, err)
+	assert.Equal(t, "a new topic", topic)
+	purpose, err := client.SetChannelPurpose("C024BE92L", "a new purpose")
+	assert.NoError(t, err)
+	assert.Equal(t, "a new purpose", purpose)
+	info, err := client.GetChannelInfo("C024BE92L")
+	assert.NoError(t, err)
+	assert.Equal(t, "a new topic", info.Topic.Value)
+	assert.Equal(t, s.BotID, info.Topic.Creator)
+	assert.Equal(t, "a new purpose", info.Purpose.Value)
+	_, err = client.SetChannelTopic("C999999999", "foo")
+	assert.EqualError(t, err, "channel_not_found")
+	assert.True(t, waitForOutboundType(s, "message"), "should have sent the topic message")
+	history, err := client.GetChannelHistory("C024BE92L", slack.NewHistoryParameters())
+	if assert.NoError(t, err) {
+		var subtypes []string
+		for _, m := range history.Messages {
+			subtypes = append(subtypes, m.SubType)
+		}
+		assert.Equal(t, []string{"channel_purpose", "channel_topic"}, subtypes, "history should include the topic and purpose changes")
+	}
+}
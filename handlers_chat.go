@@ -0,0 +1,218 @@
+package slacktest
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	slack "github.com/nlopes/slack"
+)
+
+const maxMessageLength = 40000
+const defaultRepliesLimit = 10
+
+// handle chat.update
+func chatUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	ts := values.Get("ts")
+	text := values.Get("text")
+	attaches, aErr := decodeAttachments(values)
+	if aErr != nil {
+		log.Print(aErr.Error())
+		http.Error(w, aErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if text == "" && len(attaches) == 0 {
+		writeSlackError(w, "no_text")
+		return
+	}
+	if len(text) > maxMessageLength {
+		writeSlackError(w, "msg_too_long")
+		return
+	}
+	user := s.tokenUser(requestToken(r, values))
+	slackErr := ""
+	var previous, updated slack.Message
+	found := s.messages.update(channel, ts, func(sm *storedMessage) {
+		if sm.postedBy != user {
+			slackErr = "cant_update_message"
+			return
+		}
+		previous = copyMessage(sm.message)
+		sm.edits = append(sm.edits, previous)
+		sm.message.Text = text
+		if _, set := values["attachments"]; set {
+			sm.message.Attachments = attaches
+		}
+		sm.message.Edited = &slack.Edited{
+			User:      user,
+			Timestamp: newTimestamp(),
+		}
+		updated = copyMessage(sm.message)
+	})
+	if !found {
+		slackErr = "message_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	evt := messageChangedEvent{
+		SubMessage:      &updated.Msg,
+		PreviousMessage: &previous.Msg,
+	}
+	evt.Type = slack.TYPE_MESSAGE
+	evt.SubType = "message_changed"
+	evt.Hidden = true
+	evt.Channel = channel
+	evt.Timestamp = updated.Edited.Timestamp
+	evt.EventTimestamp = updated.Edited.Timestamp
+	queueEventForWebsocket(evt, s.ServerAddr, apiMethod(r))
+	resp := struct {
+		slack.WebResponse
+		Channel string `json:"channel"`
+		Ts      string `json:"ts"`
+		Text    string `json:"text"`
+	}{
+		WebResponse: okWebResponse,
+		Channel:     channel,
+		Ts:          ts,
+		Text:        text,
+	}
+	writeJSON(w, resp)
+}
+
+// handle chat.delete
+func chatDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	ts := values.Get("ts")
+	user := s.tokenUser(requestToken(r, values))
+	if _, found := s.messages.get(channel, ts); !found {
+		writeSlackError(w, "message_not_found")
+		return
+	}
+	deleted, removed := s.messages.remove(channel, ts, func(sm *storedMessage) bool {
+		return sm.postedBy == user
+	})
+	if !removed {
+		writeSlackError(w, "cant_delete_message")
+		return
+	}
+	evt := messageChangedEvent{
+		PreviousMessage: &deleted.Msg,
+	}
+	evt.Type = slack.TYPE_MESSAGE
+	evt.SubType = "message_deleted"
+	evt.Hidden = true
+	evt.Channel = channel
+	evt.Timestamp = newTimestamp()
+	evt.EventTimestamp = evt.Timestamp
+	evt.DeletedTimestamp = ts
+	queueEventForWebsocket(evt, s.ServerAddr, apiMethod(r))
+	resp := struct {
+		slack.WebResponse
+		Channel string `json:"channel"`
+		Ts      string `json:"ts"`
+	}{
+		WebResponse: okWebResponse,
+		Channel:     channel,
+		Ts:          ts,
+	}
+	writeJSON(w, resp)
+}
+
+// handle channels.replies
+func channelsRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	messages, found := s.messages.thread(values.Get("channel"), values.Get("thread_ts"))
+	if !found {
+		writeSlackError(w, "thread_not_found")
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		slack.History
+	}{
+		WebResponse: okWebResponse,
+		History: slack.History{
+			Messages: messages,
+		},
+	}
+	writeJSON(w, resp)
+}
+
+// handle conversations.replies
+func conversationsRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	if _, found := s.conversation(s.tokenUser(requestToken(r, values)), values.Get("channel")); !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	messages, found := s.messages.thread(values.Get("channel"), values.Get("ts"))
+	if !found {
+		writeSlackError(w, "thread_not_found")
+		return
+	}
+	limit := defaultRepliesLimit
+	if l := values.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			writeSlackError(w, "invalid_limit")
+			return
+		}
+	}
+	start := 0
+	if c := values.Get("cursor"); c != "" {
+		ts, cErr := decodeCursor("ts", c)
+		if cErr != nil {
+			writeSlackError(w, "invalid_cursor")
+			return
+		}
+		start = -1
+		for i, m := range messages {
+			if m.Timestamp == ts {
+				start = i
+				break
+			}
+		}
+		if start == -1 {
+			writeSlackError(w, "invalid_cursor")
+			return
+		}
+	}
+	end := len(messages)
+	if start+limit < end {
+		end = start + limit
+	}
+	cursor := ""
+	if end < len(messages) {
+		cursor = encodeCursor("ts", messages[end].Timestamp)
+	}
+	resp := struct {
+		slack.WebResponse
+		Messages         []slack.Message  `json:"messages"`
+		HasMore          bool             `json:"has_more"`
+		ResponseMetadata responseMetadata `json:"response_metadata"`
+	}{
+		WebResponse:      okWebResponse,
+		Messages:         messages[start:end],
+		HasMore:          cursor != "",
+		ResponseMetadata: responseMetadata{NextCursor: cursor},
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,313 @@
+package slacktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatUpdateHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channel, ts, err := client.PostMessage("C024BE92L", "working...", slack.PostMessageParameters{AsUser: true})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, updatedTs, text, err := client.UpdateMessage(channel, ts, "done!")
+	assert.NoError(t, err)
+	assert.Equal(t, ts, updatedTs)
+	assert.Equal(t, "done!", text)
+	m, err := s.GetMessage(channel, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, "done!", m.Text)
+	if assert.NotNil(t, m.Edited) {
+		assert.Equal(t, s.BotID, m.Edited.User)
+	}
+	edits, err := s.GetMessageEdits(channel, ts)
+	assert.NoError(t, err)
+	if assert.Len(t, edits, 1) {
+		assert.Equal(t, "working...", edits[0].Text)
+	}
+	changed := waitForOutbound(s, func(m string) bool {
+		return strings.Contains(m, `"subtype":"message_changed"`) && strings.Contains(m, `"text":"done!"`)
+	})
+	assert.True(t, changed, "should have sent message_changed")
+	_, _, _, err = client.UpdateMessage(channel, "1.000000", "done!")
+	assert.EqualError(t, err, "message_not_found")
+}
+
+func TestChatUpdateHandlerOtherUsersMessage(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	s.SendMessageToChannel("C024BE92L", "a human message")
+	s.messages.RLock()
+	ts := s.messages.messages[0].message.Timestamp
+	s.messages.RUnlock()
+	_, _, _, err := client.UpdateMessage("C024BE92L", ts, "edited by the bot")
+	assert.EqualError(t, err, "cant_update_message")
+	_, _, err = client.DeleteMessage("C024BE92L", ts)
+	assert.EqualError(t, err, "cant_delete_message")
+}
+
+func TestChatUpdateAndDeleteUseTokenUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	s.AddToken("xoxp-observer", s.defaultUser.ID)
+	bot := slack.New("ABCDEFG")
+	user := slack.New("xoxp-observer")
+	channel, botTs, err := bot.PostMessage("C024BE92L", "from the bot", slack.PostMessageParameters{AsUser: true})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, userTs, err := user.PostMessage("C024BE92L", "from the user", slack.PostMessageParameters{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, _, _, err = user.UpdateMessage(channel, botTs, "edited by the user")
+	assert.EqualError(t, err, "cant_update_message")
+	_, _, err = bot.DeleteMessage(channel, userTs)
+	assert.EqualError(t, err, "cant_delete_message")
+	_, _, _, err = user.UpdateMessage(channel, userTs, "edited by the user")
+	assert.NoError(t, err)
+	m, err := s.GetMessage(channel, userTs)
+	if assert.NoError(t, err) && assert.NotNil(t, m.Edited) {
+		assert.Equal(t, s.defaultUser.ID, m.Edited.User)
+	}
+	_, _, err = user.DeleteMessage(channel, userTs)
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestConversationsRepliesUsesTokenUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	s.AddUser(slack.User{ID: "W0NEWUSER", Name: "newuser"})
+	s.AddToken("xoxp-observer", s.defaultUser.ID)
+	user := slack.New("xoxp-observer")
+	_, _, id, err := user.OpenIMChannel("W0NEWUSER")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, parentTs, err := user.PostMessage(id, "parent", slack.PostMessageParameters{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, _, err = user.PostMessage(id, "reply", slack.PostMessageParameters{ThreadTimestamp: parentTs})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	type repliesResponse struct {
+		slack.WebResponse
+		Messages []slack.Message `json:"messages"`
+	}
+	replies := repliesResponse{}
+	postDecode(t, s, "conversations.replies", url.Values{"channel": {id}, "ts": {parentTs}}, &replies)
+	assert.EqualError(t, replies.Error, "channel_not_found", "the bot isn't a member of the direct message")
+	replies = repliesResponse{}
+	postDecode(t, s, "conversations.replies", url.Values{"token": {"xoxp-observer"}, "channel": {id}, "ts": {parentTs}}, &replies)
+	assert.True(t, replies.Ok)
+	assert.Len(t, replies.Messages, 2)
+	s.Stop()
+}
+
+func TestChatDeleteHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channel, ts, err := client.PostMessage("C024BE92L", "temporary", slack.PostMessageParameters{AsUser: true})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, deletedTs, err := client.DeleteMessage(channel, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, ts, deletedTs)
+	_, err = s.GetMessage(channel, ts)
+	assert.EqualError(t, err, ErrMessageNotFound.Error())
+	_, _, err = client.DeleteMessage(channel, ts)
+	assert.EqualError(t, err, "message_not_found")
+	deleted := waitForOutbound(s, func(m string) bool {
+		return strings.Contains(m, `"subtype":"message_deleted"`) && strings.Contains(m, `"deleted_ts":"`+ts+`"`)
+	})
+	assert.True(t, deleted, "should have sent message_deleted")
+}
+
+func TestPostMessageHandlerThreadReply(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	parentTs := s.SendMessageToChannel("C024BE92L", "can someone help?")
+	assert.False(t, s.BotRepliedInThread("C024BE92L", parentTs))
+	_, replyTs, err := client.PostMessage("C024BE92L", "on it", slack.PostMessageParameters{AsUser: true, ThreadTimestamp: parentTs})
+	assert.NoError(t, err)
+	assert.True(t, s.BotRepliedInThread("C024BE92L", parentTs))
+	userReplyTs := s.SendThreadReplyToChannel("C024BE92L", parentTs, "thanks!")
+	parent, err := s.GetMessage("C024BE92L", parentTs)
+	assert.NoError(t, err)
+	assert.Equal(t, parentTs, parent.ThreadTimestamp)
+	assert.Equal(t, 2, parent.ReplyCount)
+	assert.Equal(t, []slack.Reply{{User: s.BotID, Timestamp: replyTs}, {User: "W012A3CDE", Timestamp: userReplyTs}}, parent.Replies)
+	replies, err := s.GetThreadReplies("C024BE92L", parentTs)
+	assert.NoError(t, err)
+	if assert.Len(t, replies, 2) {
+		assert.Equal(t, "on it", replies[0].Text)
+		assert.Equal(t, "W012A3CDE", replies[0].ParentUserId)
+		assert.Equal(t, "thanks!", replies[1].Text)
+	}
+	assert.True(t, waitForOutbound(s, func(m string) bool {
+		return strings.Contains(m, `"subtype":"message_replied"`)
+	}), "should have sent message_replied")
+}
+
+func TestPostMessageHandlerRejects(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	archived := slack.Channel{}
+	archived.ID = "C0ARCHIVED"
+	archived.Name = "old"
+	archived.IsArchived = true
+	s.AddChannel(archived)
+	cases := []struct {
+		channel  string
+		text     string
+		expected string
+	}{
+		{"", "nowhere", "channel_not_found"},
+		{"C0ARCHIVED", "archived", "is_archived"},
+		{"C024BE91L", strings.Repeat("a", maxPostMessageLength+1), "msg_too_long"},
+	}
+	for _, tc := range cases {
+		resp := slack.WebResponse{}
+		postDecode(t, s, "chat.postMessage", url.Values{"channel": {tc.channel}, "text": {tc.text}}, &resp)
+		assert.False(t, resp.Ok)
+		assert.EqualError(t, resp.Error, tc.expected)
+	}
+	assert.False(t, s.SawOutgoingMessage("nowhere"), "rejected messages should not be posted")
+	assert.False(t, s.SawOutgoingMessage("archived"), "rejected messages should not be posted")
+
+	// like Slack's channel names, channels the server doesn't know about can be posted to
+	resp := slack.WebResponse{}
+	postDecode(t, s, "chat.postMessage", url.Values{"channel": {"#general"}, "text": {"unknown"}}, &resp)
+	assert.True(t, resp.Ok)
+	s.Stop()
+}
+
+func TestThreadReplySentBeforeMessageReplied(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	parentTs := s.SendMessageToChannel("C024BE92L", "can someone help?")
+	s.SendThreadReplyToChannel("C024BE92L", parentTs, "me too")
+	_, _, err := slack.New("ABCDEFG").PostMessage("C024BE92L", "on it", slack.PostMessageParameters{AsUser: true, ThreadTimestamp: parentTs})
+	assert.NoError(t, err)
+	var order []string
+	for _, e := range s.GetOutboundEvents(EventOfType(slack.TYPE_MESSAGE), EventInChannel("C024BE92L")) {
+		if e.SubType == "message_replied" {
+			order = append(order, e.SubType)
+		} else {
+			order = append(order, e.Text)
+		}
+	}
+	assert.Equal(t, []string{"can someone help?", "me too", "message_replied", "on it", "message_replied"}, order,
+		"each reply should be sent before the message_replied event about it")
+	s.Stop()
+}
+
+func TestPostMessageHandlerReplyBroadcast(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	parentTs := s.SendMessageToChannel("C024BE92L", "can someone help?")
+	resp, err := http.PostForm(s.GetAPIURL()+"chat.postMessage", url.Values{
+		"channel":         {"C024BE92L"},
+		"text":            {"everyone look"},
+		"as_user":         {"true"},
+		"thread_ts":       {parentTs},
+		"reply_broadcast": {"true"},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	posted := struct {
+		Ok bool   `json:"ok"`
+		Ts string `json:"ts"`
+	}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&posted))
+	_ = resp.Body.Close()
+	assert.True(t, posted.Ok)
+	m, err := s.GetMessage("C024BE92L", posted.Ts)
+	assert.NoError(t, err)
+	assert.Equal(t, "thread_broadcast", m.SubType)
+}
+
+func TestChannelsRepliesHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	parentTs := s.SendMessageToChannel("C024BE92L", "parent")
+	s.SendThreadReplyToChannel("C024BE92L", parentTs, "first")
+	s.SendThreadReplyToChannel("C024BE92L", parentTs, "second")
+	messages, err := client.GetChannelReplies("C024BE92L", parentTs)
+	assert.NoError(t, err)
+	if assert.Len(t, messages, 3) {
+		assert.Equal(t, "parent", messages[0].Text)
+		assert.Equal(t, "first", messages[1].Text)
+		assert.Equal(t, "second", messages[2].Text)
+	}
+	_, err = client.GetChannelReplies("C024BE92L", "1.000000")
+	assert.EqualError(t, err, "thread_not_found")
+}
+
+func TestConversationsRepliesHandlerPagination(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	parentTs := s.SendMessageToChannel("C024BE92L", "parent")
+	s.SendThreadReplyToChannel("C024BE92L", parentTs, "first")
+	s.SendThreadReplyToChannel("C024BE92L", parentTs, "second")
+	type repliesResponse struct {
+		Ok               bool            `json:"ok"`
+		Messages         []slack.Message `json:"messages"`
+		HasMore          bool            `json:"has_more"`
+		ResponseMetadata struct {
+			NextCursor string `json:"next_cursor"`
+		} `json:"response_metadata"`
+	}
+	var texts []string
+	cursor := ""
+	for i := 0; i < 3; i++ {
+		resp, err := http.PostForm(s.GetAPIURL()+"conversations.replies", url.Values{
+			"channel": {"C024BE92L"},
+			"ts":      {parentTs},
+			"limit":   {"2"},
+			"cursor":  {cursor},
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		page := repliesResponse{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		_ = resp.Body.Close()
+		assert.True(t, page.Ok)
+		for _, m := range page.Messages {
+			texts = append(texts, m.Text)
+		}
+		cursor = page.ResponseMetadata.NextCursor
+		assert.Equal(t, cursor != "", page.HasMore)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"parent", "first", "second"}, texts)
+}
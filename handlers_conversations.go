@@ -0,0 +1,357 @@
+package slacktest
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	slack "github.com/nlopes/slack"
+)
+
+const defaultConversationsLimit = 100
+const maxConversationsLimit = 1000
+
+// conversationRef is how conversations.open describes a direct message unless asked for the whole channel
+type conversationRef struct {
+	ID string `json:"id"`
+}
+
+// handle conversations.open
+func conversationsOpenHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	user := s.tokenUser(requestToken(r, values))
+	users := splitUsers(values.Get("users"))
+	if channel := values.Get("channel"); channel != "" {
+		if g, found := s.mpims.get(user, channel); found {
+			users = g.Members
+		} else if im, found := s.ims.get(user, channel); found {
+			users = []string{im.User}
+		} else {
+			writeSlackError(w, "channel_not_found")
+			return
+		}
+	}
+	resp := struct {
+		slack.WebResponse
+		NoOp        bool        `json:"no_op,omitempty"`
+		AlreadyOpen bool        `json:"already_open,omitempty"`
+		Channel     interface{} `json:"channel"`
+	}{WebResponse: okWebResponse}
+	switch len(users) {
+	case 0:
+		writeSlackError(w, "users_list_not_supplied")
+		return
+	case 1:
+		im, alreadyOpen, err := s.openIM(user, users[0], apiMethod(r))
+		if err != nil {
+			writeSlackError(w, "user_not_found")
+			return
+		}
+		resp.NoOp = alreadyOpen
+		resp.AlreadyOpen = alreadyOpen
+		resp.Channel = conversationRef{ID: im.ID}
+		if isTrue(values.Get("return_im")) {
+			resp.Channel = im
+		}
+	default:
+		g, err := s.openMPIM(user, users, apiMethod(r))
+		if err != nil {
+			writeSlackError(w, mpimError(err))
+			return
+		}
+		resp.Channel = asMPIM(g)
+	}
+	writeJSON(w, resp)
+}
+
+// conversationsLimit returns the `limit` parameter in `values` or the slack default.
+// It reports whether the limit is valid
+func conversationsLimit(values url.Values) (int, bool) {
+	l := values.Get("limit")
+	if l == "" {
+		return defaultConversationsLimit, true
+	}
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit < 1 {
+		return 0, false
+	}
+	if limit > maxConversationsLimit {
+		limit = maxConversationsLimit
+	}
+	return limit, true
+}
+
+// pageStart returns the index of `id` in `ids` for a cursor of `kind`, or 0 with no cursor.
+// It reports whether the cursor is valid
+func pageStart(kind, cursor string, ids []string) (int, bool) {
+	if cursor == "" {
+		return 0, true
+	}
+	id, err := decodeCursor(kind, cursor)
+	if err != nil {
+		return 0, false
+	}
+	for i := range ids {
+		if ids[i] == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// nextCursor returns the cursor for the page of `ids` after the one ending at `end`
+func nextCursor(kind string, ids []string, end int) string {
+	if end < len(ids) {
+		return encodeCursor(kind, ids[end])
+	}
+	return ""
+}
+
+func writeConversationResponse(w http.ResponseWriter, c conversationInfo) {
+	resp := struct {
+		slack.WebResponse
+		Channel conversationInfo `json:"channel"`
+	}{
+		WebResponse: okWebResponse,
+		Channel:     c,
+	}
+	writeJSON(w, resp)
+}
+
+// handle conversations.list
+func conversationsListHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	types, valid := parseConversationTypes(values.Get("types"))
+	if !valid {
+		writeSlackError(w, "invalid_types")
+		return
+	}
+	limit, valid := conversationsLimit(values)
+	if !valid {
+		writeSlackError(w, "invalid_limit")
+		return
+	}
+	excludeArchived := isTrue(values.Get("exclude_archived"))
+	conversations := []conversationInfo{}
+	var ids []string
+	for _, c := range s.conversations(s.tokenUser(requestToken(r, values))) {
+		if hasMember(types, conversationType(c)) && !(excludeArchived && c.IsArchived) {
+			conversations = append(conversations, c)
+			ids = append(ids, c.ID)
+		}
+	}
+	start, valid := pageStart("channel", values.Get("cursor"), ids)
+	if !valid {
+		writeSlackError(w, "invalid_cursor")
+		return
+	}
+	end := len(conversations)
+	if start+limit < end {
+		end = start + limit
+	}
+	resp := struct {
+		slack.WebResponse
+		Channels         []conversationInfo `json:"channels"`
+		ResponseMetadata responseMetadata   `json:"response_metadata"`
+	}{
+		WebResponse:      okWebResponse,
+		Channels:         conversations[start:end],
+		ResponseMetadata: responseMetadata{NextCursor: nextCursor("channel", ids, end)},
+	}
+	writeJSON(w, resp)
+}
+
+// handle conversations.info
+func conversationsInfoHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	c, found := s.conversation(s.tokenUser(requestToken(r, values)), values.Get("channel"))
+	if !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	writeConversationResponse(w, c)
+}
+
+// handle conversations.members
+func conversationsMembersHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	c, found := s.conversation(s.tokenUser(requestToken(r, values)), values.Get("channel"))
+	if !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	limit, valid := conversationsLimit(values)
+	if !valid {
+		writeSlackError(w, "invalid_limit")
+		return
+	}
+	start, valid := pageStart("user", values.Get("cursor"), c.members)
+	if !valid {
+		writeSlackError(w, "invalid_cursor")
+		return
+	}
+	end := len(c.members)
+	if start+limit < end {
+		end = start + limit
+	}
+	resp := struct {
+		slack.WebResponse
+		Members          []string         `json:"members"`
+		ResponseMetadata responseMetadata `json:"response_metadata"`
+	}{
+		WebResponse:      okWebResponse,
+		Members:          append([]string{}, c.members[start:end]...),
+		ResponseMetadata: responseMetadata{NextCursor: nextCursor("user", c.members, end)},
+	}
+	writeJSON(w, resp)
+}
+
+// handle conversations.create
+func conversationsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(values.Get("name"), "#")
+	if slackErr := validateChannelName(name); slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	if s.nameTaken(name) {
+		writeSlackError(w, "name_taken")
+		return
+	}
+	user := s.tokenUser(requestToken(r, values))
+	if isTrue(values.Get("is_private")) {
+		writeConversationResponse(w, groupConversation(s.createGroup(name, user, apiMethod(r)), user))
+		return
+	}
+	c, created := s.createChannel(name, user, apiMethod(r))
+	if !created {
+		writeSlackError(w, "name_taken")
+		return
+	}
+	writeConversationResponse(w, channelConversation(c, user))
+}
+
+// handle conversations.join
+func conversationsJoinHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	user := s.tokenUser(requestToken(r, values))
+	c, found := s.conversation(user, values.Get("channel"))
+	switch {
+	case !found:
+		writeSlackError(w, "channel_not_found")
+		return
+	case !c.IsChannel:
+		writeSlackError(w, "method_not_supported_for_channel_type")
+		return
+	case c.IsArchived:
+		writeSlackError(w, "is_archived")
+		return
+	}
+	joined, alreadyIn := s.joinChannel(c.ID, user, apiMethod(r))
+	resp := struct {
+		slack.WebResponse
+		Channel          conversationInfo `json:"channel"`
+		Warning          string           `json:"warning,omitempty"`
+		ResponseMetadata struct {
+			Warnings []string `json:"warnings,omitempty"`
+		} `json:"response_metadata"`
+	}{
+		WebResponse: okWebResponse,
+		Channel:     channelConversation(joined, user),
+	}
+	if alreadyIn {
+		resp.Warning = "already_in_channel"
+		resp.ResponseMetadata.Warnings = []string{resp.Warning}
+	}
+	writeJSON(w, resp)
+}
+
+// handle conversations.invite
+func conversationsInviteHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("channel")
+	user := s.tokenUser(requestToken(r, values))
+	users := splitUsers(values.Get("users"))
+	if len(users) == 0 {
+		writeSlackError(w, "no_user")
+		return
+	}
+	known := s.GetUsers()
+	for _, u := range users {
+		if _, userFound := findUser(known, u); !userFound {
+			writeSlackError(w, "user_not_found")
+			return
+		}
+		if u == user {
+			writeSlackError(w, "cant_invite_self")
+			return
+		}
+	}
+	slackErr := ""
+	var added []string
+	invite := func(archived bool, members *[]string) {
+		if archived {
+			slackErr = "is_archived"
+			return
+		}
+		for _, u := range users {
+			if !hasMember(*members, u) {
+				*members = append(*members, u)
+				added = append(added, u)
+			}
+		}
+		if len(added) == 0 {
+			slackErr = "already_in_channel"
+		}
+	}
+	channelType := "C"
+	found := s.channels.update(id, func(c *slack.Channel) { invite(c.IsArchived, &c.Members) })
+	if !found {
+		channelType = "G"
+		found = s.groups.update(id, func(g *slack.Group) { invite(g.IsArchived, &g.Members) })
+	}
+	if !found {
+		slackErr = "channel_not_found"
+		if _, isDM := s.conversation(user, id); isDM {
+			slackErr = "method_not_supported_for_channel_type"
+		}
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	for _, u := range added {
+		queueEventForWebsocket(memberJoinedChannelEvent{
+			Type:        "member_joined_channel",
+			User:        u,
+			Channel:     id,
+			ChannelType: channelType,
+			Team:        TeamFromContext(r.Context()).ID,
+			Inviter:     user,
+		}, s.ServerAddr, apiMethod(r))
+	}
+	c, _ := s.conversation(user, id)
+	writeConversationResponse(w, c)
+}
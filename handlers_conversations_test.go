@@ -0,0 +1,212 @@
+package slacktest
+
+import (
+	"net/url"
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+type conversationResponse struct {
+	slack.WebResponse
+	Channel          conversationInfo   `json:"channel"`
+	Channels         []conversationInfo `json:"channels"`
+	Members          []string           `json:"members"`
+	Warning          string             `json:"warning"`
+	ResponseMetadata responseMetadata   `json:"response_metadata"`
+}
+
+func TestConversationsListHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W0PAGER", Name: "pager"})
+	s.AddUser(slack.User{ID: "W0COMMANDER", Name: "commander"})
+	mpim, err := s.OpenMPIM("W0PAGER", "W0COMMANDER")
+	assert.NoError(t, err)
+
+	list := conversationResponse{}
+	postDecode(t, s, "conversations.list", url.Values{}, &list)
+	if assert.Len(t, list.Channels, 2, "only public channels are listed by default") {
+		assert.Equal(t, "C024BE91L", list.Channels[0].ID)
+		assert.True(t, list.Channels[0].IsChannel)
+	}
+
+	var seen []string
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		page := conversationResponse{}
+		postDecode(t, s, "conversations.list", url.Values{
+			"types":  {"public_channel,private_channel,mpim,im"},
+			"limit":  {"2"},
+			"cursor": {cursor},
+		}, &page)
+		assert.True(t, page.Ok)
+		for _, c := range page.Channels {
+			seen = append(seen, c.ID)
+		}
+		cursor = page.ResponseMetadata.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"C024BE91L", "C024BE92L", "G024BE91L", defaultIMID, mpim}, seen)
+
+	list = conversationResponse{}
+	postDecode(t, s, "conversations.list", url.Values{"types": {"im,mpim"}}, &list)
+	if assert.Len(t, list.Channels, 2) {
+		assert.True(t, list.Channels[0].IsIM)
+		assert.Equal(t, defaultNonBotUserID, list.Channels[0].User)
+		assert.True(t, list.Channels[1].IsMpim)
+	}
+
+	c := slack.Channel{}
+	c.ID = "C0ARCHIVED"
+	c.Name = "old"
+	c.IsChannel = true
+	c.IsArchived = true
+	s.AddChannel(c)
+	list = conversationResponse{}
+	postDecode(t, s, "conversations.list", url.Values{"exclude_archived": {"true"}}, &list)
+	assert.Len(t, list.Channels, 2)
+
+	for slackErr, values := range map[string]url.Values{
+		"invalid_types":  {"types": {"public_channel,dm"}},
+		"invalid_limit":  {"limit": {"0"}},
+		"invalid_cursor": {"cursor": {encodeCursor("channel", "C000000")}},
+	} {
+		failed := conversationResponse{}
+		postDecode(t, s, "conversations.list", values, &failed)
+		assert.EqualError(t, failed.Error, slackErr)
+	}
+}
+
+func TestConversationsInfoAndMembersHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	info := conversationResponse{}
+	postDecode(t, s, "conversations.info", url.Values{"channel": {"G024BE91L"}}, &info)
+	assert.True(t, info.Ok)
+	assert.True(t, info.Channel.IsPrivate)
+	assert.Equal(t, "secretplans", info.Channel.Name)
+	assert.Equal(t, 1, info.Channel.NumMembers)
+	postDecode(t, s, "conversations.info", url.Values{"channel": {defaultIMID}}, &info)
+	assert.True(t, info.Channel.IsIM)
+	info = conversationResponse{}
+	postDecode(t, s, "conversations.info", url.Values{"channel": {"C000000"}}, &info)
+	assert.EqualError(t, info.Error, "channel_not_found")
+
+	assert.NoError(t, s.SetChannelMembers("C024BE91L", []string{"W1", "W2", "W3"}))
+	var members []string
+	cursor := ""
+	for i := 0; i < 3; i++ {
+		page := conversationResponse{}
+		postDecode(t, s, "conversations.members", url.Values{"channel": {"C024BE91L"}, "limit": {"2"}, "cursor": {cursor}}, &page)
+		members = append(members, page.Members...)
+		cursor = page.ResponseMetadata.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"W1", "W2", "W3"}, members)
+	page := conversationResponse{}
+	postDecode(t, s, "conversations.members", url.Values{"channel": {defaultIMID}}, &page)
+	assert.Equal(t, []string{s.BotID, defaultNonBotUserID}, page.Members)
+}
+
+func TestConversationsCreateJoinAndInviteHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W0PAGER", Name: "pager"})
+
+	created := conversationResponse{}
+	postDecode(t, s, "conversations.create", url.Values{"name": {"incident-1"}}, &created)
+	assert.True(t, created.Channel.IsChannel)
+	assert.True(t, created.Channel.IsMember)
+	assert.Len(t, s.GetOutboundEvents(EventOfType("channel_created")), 1)
+	private := conversationResponse{}
+	postDecode(t, s, "conversations.create", url.Values{"name": {"incident-2"}, "is_private": {"true"}}, &private)
+	assert.True(t, private.Channel.IsPrivate)
+	assert.Len(t, s.GetOutboundEvents(EventOfType("group_joined")), 1)
+	_, found := findGroup(s.GetGroups(), private.Channel.ID)
+	assert.True(t, found)
+	taken := conversationResponse{}
+	postDecode(t, s, "conversations.create", url.Values{"name": {"secretplans"}}, &taken)
+	assert.EqualError(t, taken.Error, "name_taken")
+
+	joined := conversationResponse{}
+	postDecode(t, s, "conversations.join", url.Values{"channel": {"C024BE92L"}}, &joined)
+	assert.True(t, joined.Ok)
+	assert.Empty(t, joined.Warning)
+	assert.Len(t, s.GetOutboundEvents(EventOfType("channel_joined")), 1)
+	postDecode(t, s, "conversations.join", url.Values{"channel": {"C024BE92L"}}, &joined)
+	assert.Equal(t, "already_in_channel", joined.Warning)
+	failed := conversationResponse{}
+	postDecode(t, s, "conversations.join", url.Values{"channel": {"G024BE91L"}}, &failed)
+	assert.EqualError(t, failed.Error, "method_not_supported_for_channel_type")
+
+	invited := conversationResponse{}
+	postDecode(t, s, "conversations.invite", url.Values{"channel": {private.Channel.ID}, "users": {"W0PAGER," + defaultNonBotUserID}}, &invited)
+	assert.True(t, invited.Ok)
+	assert.Equal(t, 3, invited.Channel.NumMembers)
+	joinedEvents := s.GetOutboundEvents(EventOfType("member_joined_channel"))
+	assert.Len(t, joinedEvents, 3, "one for the bot joining and one per invited user")
+	for slackErr, values := range map[string]url.Values{
+		"already_in_channel":                    {"channel": {private.Channel.ID}, "users": {"W0PAGER"}},
+		"user_not_found":                        {"channel": {created.Channel.ID}, "users": {"W000000"}},
+		"cant_invite_self":                      {"channel": {created.Channel.ID}, "users": {s.BotID}},
+		"no_user":                               {"channel": {created.Channel.ID}},
+		"channel_not_found":                     {"channel": {"C000000"}, "users": {"W0PAGER"}},
+		"method_not_supported_for_channel_type": {"channel": {defaultIMID}, "users": {"W0PAGER"}},
+	} {
+		failed := conversationResponse{}
+		postDecode(t, s, "conversations.invite", values, &failed)
+		assert.EqualError(t, failed.Error, slackErr)
+	}
+
+	replies := conversationResponse{}
+	postDecode(t, s, "conversations.replies", url.Values{"channel": {"C000000"}, "ts": {"1.000000"}}, &replies)
+	assert.EqualError(t, replies.Error, "channel_not_found")
+}
+
+func TestConversationsHandlersUseTokenUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddToken("xoxp-observer", defaultNonBotUserID)
+	asObserver := func(values url.Values) url.Values {
+		values.Set("token", "xoxp-observer")
+		return values
+	}
+
+	created := conversationResponse{}
+	postDecode(t, s, "conversations.create", asObserver(url.Values{"name": {"observers"}, "is_private": {"true"}}), &created)
+	assert.Equal(t, defaultNonBotUserID, created.Channel.Creator)
+	members := conversationResponse{}
+	postDecode(t, s, "conversations.members", asObserver(url.Values{"channel": {created.Channel.ID}}), &members)
+	assert.Equal(t, []string{defaultNonBotUserID}, members.Members)
+	info := conversationResponse{}
+	postDecode(t, s, "conversations.info", asObserver(url.Values{"channel": {created.Channel.ID}}), &info)
+	assert.True(t, info.Channel.IsMember)
+	info = conversationResponse{}
+	postDecode(t, s, "conversations.info", url.Values{"channel": {created.Channel.ID}}, &info)
+	assert.False(t, info.Channel.IsMember, "the bot isn't a member of the token user's private channel")
+
+	invited := conversationResponse{}
+	postDecode(t, s, "conversations.invite", asObserver(url.Values{"channel": {created.Channel.ID}, "users": {s.BotID}}), &invited)
+	assert.True(t, invited.Ok)
+	joinedEvents := s.GetOutboundEvents(EventOfType("member_joined_channel"))
+	if assert.NotEmpty(t, joinedEvents) {
+		assert.Contains(t, joinedEvents[len(joinedEvents)-1].Raw, `"inviter":"`+defaultNonBotUserID+`"`)
+	}
+	failed := conversationResponse{}
+	postDecode(t, s, "conversations.invite", asObserver(url.Values{"channel": {created.Channel.ID}, "users": {defaultNonBotUserID}}), &failed)
+	assert.EqualError(t, failed.Error, "cant_invite_self")
+
+	joined := conversationResponse{}
+	postDecode(t, s, "conversations.join", asObserver(url.Values{"channel": {"C024BE92L"}}), &joined)
+	assert.True(t, joined.Ok)
+	members = conversationResponse{}
+	postDecode(t, s, "conversations.members", url.Values{"channel": {"C024BE92L"}}, &members)
+	assert.Contains(t, members.Members, defaultNonBotUserID)
+	s.Stop()
+}
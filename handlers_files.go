@@ -0,0 +1,254 @@
+package slacktest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	slack "github.com/nlopes/slack"
+)
+
+const defaultFilesListCount = 100
+
+// maxUploadMemory is how much of a multipart upload is held in memory before spilling to disk
+const maxUploadMemory = 32 << 20
+
+// fileResponse is the response to the files.* methods that return a single file
+type fileResponse struct {
+	slack.WebResponse
+	File     slack.File      `json:"file"`
+	Comments []slack.Comment `json:"comments"`
+	Paging   slack.Paging    `json:"paging"`
+}
+
+// handle files.upload
+func filesUploadHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := serverFromContext(r.Context())
+	if err != nil {
+		log.Print(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pErr := r.ParseMultipartForm(maxUploadMemory); pErr != nil && pErr != http.ErrNotMultipart {
+		msg := fmt.Sprintf("Unable to decode request: %s", pErr.Error())
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	values := r.Form
+	name := values.Get("filename")
+	var content []byte
+	snippet := false
+	if file, header, fErr := r.FormFile("file"); fErr == nil {
+		content, err = ioutil.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			msg := fmt.Sprintf("Unable to read uploaded file: %s", err.Error())
+			log.Print(msg)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		if name == "" {
+			name = header.Filename
+		}
+	} else if c, set := values["content"]; set {
+		content = []byte(c[0])
+		snippet = true
+	} else {
+		writeSlackError(w, "no_file_data")
+		return
+	}
+	if name == "" {
+		name = "-"
+	}
+	// files belong to whoever the token authenticates as, such as an observer added with AddToken
+	f := newFile(s.tokenUser(requestToken(r, values)), name, values.Get("filetype"), content, snippet)
+	if title := values.Get("title"); title != "" {
+		f.Title = title
+	}
+	if comment := values.Get("initial_comment"); comment != "" {
+		f.InitialComment = slack.Comment{
+			ID:        newID("Fc"),
+			Created:   f.Created,
+			Timestamp: f.Timestamp,
+			User:      f.User,
+			Comment:   comment,
+		}
+		f.CommentsCount = 1
+	}
+	var channels []string
+	if c := values.Get("channels"); c != "" {
+		channels = strings.Split(c, ",")
+	}
+	f = s.uploadFile(f, content, channels, apiMethod(r))
+	writeJSON(w, fileResponse{WebResponse: okWebResponse, File: f, Comments: []slack.Comment{}})
+}
+
+// handle files.info
+func filesInfoHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	f, err := s.GetFile(values.Get("file"))
+	if err != nil {
+		writeSlackError(w, "file_not_found")
+		return
+	}
+	writeJSON(w, fileResponse{
+		WebResponse: okWebResponse,
+		File:        f,
+		Comments:    []slack.Comment{},
+		Paging:      slack.Paging{Count: defaultFilesListCount, Page: 1},
+	})
+}
+
+// handle files.list
+func filesListHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	count := defaultFilesListCount
+	if c, err := strconv.Atoi(values.Get("count")); err == nil && c > 0 {
+		count = c
+	}
+	page := 1
+	if p, err := strconv.Atoi(values.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	tsFrom, _ := strconv.ParseInt(values.Get("ts_from"), 10, 64)
+	tsTo, toErr := strconv.ParseInt(values.Get("ts_to"), 10, 64)
+	user := values.Get("user")
+	channel := values.Get("channel")
+	// slack lists the most recent files first
+	all := s.GetFiles()
+	var files []slack.File
+	for i := len(all) - 1; i >= 0; i-- {
+		f := all[i]
+		switch {
+		case user != "" && f.User != user:
+		case channel != "" && !fileSharedIn(f, channel):
+		case !fileMatchesTypes(f, values.Get("types")):
+		case int64(f.Created) < tsFrom:
+		case toErr == nil && tsTo >= 0 && int64(f.Created) > tsTo:
+		default:
+			files = append(files, f)
+		}
+	}
+	listed := []slack.File{}
+	start := (page - 1) * count
+	for i := start; i < len(files) && i < start+count; i++ {
+		listed = append(listed, files[i])
+	}
+	resp := struct {
+		slack.WebResponse
+		Files  []slack.File `json:"files"`
+		Paging slack.Paging `json:"paging"`
+	}{
+		WebResponse: okWebResponse,
+		Files:       listed,
+		Paging: slack.Paging{
+			Count: count,
+			Total: len(files),
+			Page:  page,
+			Pages: (len(files) + count - 1) / count,
+		},
+	}
+	writeJSON(w, resp)
+}
+
+// handle files.delete
+func filesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	user := s.tokenUser(requestToken(r, values))
+	f, deleted := s.files.remove(values.Get("file"), func(f slack.File) bool {
+		return f.User == user
+	})
+	if !deleted {
+		if f.ID == "" {
+			writeSlackError(w, "file_not_found")
+		} else {
+			writeSlackError(w, "cant_delete_file")
+		}
+		return
+	}
+	queueEventForWebsocket(fileEvent{
+		Type:           "file_deleted",
+		FileID:         f.ID,
+		EventTimestamp: newTimestamp(),
+	}, s.ServerAddr, apiMethod(r))
+	writeJSON(w, okWebResponse)
+}
+
+// handle files.sharedPublicURL
+func filesSharedPublicURLHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	id := values.Get("file")
+	user := s.tokenUser(requestToken(r, values))
+	slackErr := ""
+	var shared slack.File
+	found := s.files.update(id, func(f *slack.File) {
+		switch {
+		case f.User != user:
+			slackErr = "not_allowed"
+		case f.PublicURLShared:
+			slackErr = "already_public"
+		default:
+			f.PublicURLShared = true
+			f.IsPublic = true
+			f.PermalinkPublic = f.URLPrivate + "?pub_secret=" + strings.ToLower(newID("s"))
+			shared = copyFile(*f)
+		}
+	})
+	if !found {
+		slackErr = "file_not_found"
+	}
+	if slackErr != "" {
+		writeSlackError(w, slackErr)
+		return
+	}
+	queueEventForWebsocket(fileEvent{
+		Type:           "file_public",
+		FileID:         shared.ID,
+		File:           fileRef{ID: shared.ID},
+		UserID:         shared.User,
+		EventTimestamp: newTimestamp(),
+	}, s.ServerAddr, apiMethod(r))
+	writeJSON(w, fileResponse{
+		WebResponse: okWebResponse,
+		File:        shared,
+		Comments:    []slack.Comment{},
+		Paging:      slack.Paging{Count: defaultFilesListCount, Page: 1},
+	})
+}
+
+// fileContentHandler serves the content of uploaded files from their private url
+func fileContentHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := serverFromContext(r.Context())
+	if err != nil {
+		log.Print(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := strings.SplitN(strings.TrimPrefix(r.URL.Path, filesPath), "/", 2)[0]
+	f, content, ok := s.files.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", f.Mimetype)
+	if r.URL.Query().Get("download") != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.Name))
+	}
+	_, _ = w.Write(content)
+}
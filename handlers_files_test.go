@@ -0,0 +1,194 @@
+package slacktest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesUploadHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	snippet, err := client.UploadFile(slack.FileUploadParameters{
+		Content:        "hello\nworld",
+		Filename:       "notes.txt",
+		Title:          "Notes",
+		InitialComment: "see attached",
+		Channels:       []string{"C024BE91L"},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "notes.txt", snippet.Name)
+	assert.Equal(t, "Notes", snippet.Title)
+	assert.Equal(t, "snippet", snippet.Mode)
+	assert.Equal(t, 2, snippet.Lines)
+	assert.Equal(t, s.BotID, snippet.User)
+	assert.Equal(t, []string{"C024BE91L"}, snippet.Channels)
+	assert.Equal(t, "see attached", snippet.InitialComment.Comment)
+
+	report, err := client.UploadFile(slack.FileUploadParameters{
+		Reader:   bytes.NewBufferString("a,b\n1,2\n"),
+		Filename: "report.csv",
+		Channels: []string{"C024BE92L", "G024BE91L"},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "csv", report.Filetype)
+	assert.Equal(t, "hosted", report.Mode)
+	assert.Equal(t, 8, report.Size)
+	assert.Equal(t, []string{"C024BE92L"}, report.Channels)
+	assert.Equal(t, []string{"G024BE91L"}, report.Groups)
+	content, err := s.GetFileContent(report.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b\n1,2\n", string(content))
+	assert.True(t, s.BotUploadedFile("C024BE92L", "report.csv"))
+	assert.False(t, s.BotUploadedFile("C024BE91L", "report.csv"))
+
+	resp, err := http.Get(report.URLPrivate)
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, "a,b\n1,2\n", string(body), "private url should serve the uploaded bytes")
+	}
+	assert.Len(t, s.APICalls("files.upload"), 2, "downloads aren't Web API calls")
+
+	assert.Len(t, s.GetOutboundEvents(EventOfType("file_created")), 2)
+	shared := s.GetOutboundEvents(EventOfType("file_shared"))
+	if assert.Len(t, shared, 3) {
+		assert.Equal(t, "C024BE91L", shared[0].Channel)
+	}
+	resp = postStatus(t, s, "files.upload", url.Values{"filename": {"empty"}})
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.JSONEq(t, `{"ok":false,"error":"no_file_data"}`, string(body))
+}
+
+func TestFilesInfoListAndDeleteHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	other := s.AddFile(slack.File{Name: "cat.png", Filetype: "png", Mimetype: "image/png", User: "W012A3CDE", Channels: []string{"C024BE91L"}}, []byte("png"))
+	mine, err := client.UploadFile(slack.FileUploadParameters{Content: "log", Filename: "build.log", Channels: []string{"C024BE92L"}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	f, _, _, err := client.GetFileInfo(other.ID, 0, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "cat.png", f.Name)
+		assert.Equal(t, 3, f.Size)
+	}
+	_, _, _, err = client.GetFileInfo("F000000", 0, 1)
+	assert.EqualError(t, err, "file_not_found")
+
+	params := slack.NewGetFilesParameters()
+	files, paging, err := client.GetFiles(params)
+	if assert.NoError(t, err) && assert.Len(t, files, 2) {
+		assert.Equal(t, mine.ID, files[0].ID, "most recent files come first")
+		assert.Equal(t, 2, paging.Total)
+	}
+	params.User = "W012A3CDE"
+	files, _, _ = client.GetFiles(params)
+	assert.Len(t, files, 1)
+	params = slack.NewGetFilesParameters()
+	params.Channel = "C024BE92L"
+	files, _, _ = client.GetFiles(params)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, mine.ID, files[0].ID)
+	}
+	params = slack.NewGetFilesParameters()
+	params.Types = "images"
+	files, _, _ = client.GetFiles(params)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, other.ID, files[0].ID)
+	}
+	params.Types = "snippets,pdfs"
+	files, _, _ = client.GetFiles(params)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, mine.ID, files[0].ID)
+	}
+
+	assert.EqualError(t, client.DeleteFile(other.ID), "cant_delete_file")
+	assert.NoError(t, client.DeleteFile(mine.ID))
+	assert.EqualError(t, client.DeleteFile(mine.ID), "file_not_found")
+	_, err = s.GetFile(mine.ID)
+	assert.EqualError(t, err, ErrFileNotFound.Error())
+	assert.Len(t, s.GetOutboundEvents(EventOfType("file_deleted")), 1)
+}
+
+func TestFilesSharedPublicURLHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	f, err := client.UploadFile(slack.FileUploadParameters{Content: "public", Filename: "share.txt"})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.False(t, f.PublicURLShared)
+	shared, _, _, err := client.ShareFilePublicURL(f.ID)
+	if assert.NoError(t, err) {
+		assert.True(t, shared.PublicURLShared)
+		assert.NotEmpty(t, shared.PermalinkPublic)
+		resp, gErr := http.Get(shared.PermalinkPublic)
+		if assert.NoError(t, gErr) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			assert.Equal(t, "public", string(body))
+		}
+	}
+	_, _, _, err = client.ShareFilePublicURL(f.ID)
+	assert.EqualError(t, err, "already_public")
+	assert.Len(t, s.GetOutboundEvents(EventOfType("file_public")), 1)
+}
+
+func TestFilesUploadedWithAddedToken(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	s.AddToken("xoxp-observer", defaultNonBotUserID)
+	observer := slack.New("xoxp-observer")
+	f, err := observer.UploadFile(slack.FileUploadParameters{Content: "q3", Filename: "q3 report#1.csv", Channels: []string{"C024BE91L"}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, defaultNonBotUserID, f.User, "files belong to the user the token authenticates as")
+	assert.False(t, s.BotUploadedFile("C024BE91L", "q3 report#1.csv"))
+	params := slack.NewGetFilesParameters()
+	params.User = defaultNonBotUserID
+	files, _, _ := observer.GetFiles(params)
+	assert.Len(t, files, 1)
+
+	resp, err := http.Get(f.URLPrivate)
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, "q3", string(body), "names are escaped in the private url")
+	}
+	assert.EqualError(t, slack.New("ABCDEFG").DeleteFile(f.ID), "cant_delete_file")
+	assert.NoError(t, observer.DeleteFile(f.ID))
+}
+
+func TestFilesUploadToRepeatedChannel(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	f, err := client.UploadFile(slack.FileUploadParameters{Content: "once", Filename: "once.txt", Channels: []string{"C024BE91L", "C024BE91L"}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"C024BE91L"}, f.Channels)
+	assert.Len(t, s.GetOutboundEvents(EventOfType("file_shared")), 1, "a file is only shared once in each channel")
+	s.Stop()
+}
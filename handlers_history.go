@@ -0,0 +1,159 @@
+package slacktest
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	slack "github.com/nlopes/slack"
+)
+
+const defaultHistoryCount = 100
+const maxHistoryCount = 1000
+
+// historyWindow returns the `messages` between `latest` and `oldest`, most recent first like slack.
+// `messages` must be oldest first
+func historyWindow(messages []slack.Message, latest, oldest string, inclusive bool) []slack.Message {
+	latestAt, hasLatest := timestampTime(latest)
+	oldestAt, hasOldest := timestampTime(oldest)
+	window := []slack.Message{}
+	for i := len(messages) - 1; i >= 0; i-- {
+		at, ok := timestampTime(messages[i].Timestamp)
+		switch {
+		case !ok:
+		case hasLatest && (at.After(latestAt) || (!inclusive && at.Equal(latestAt))):
+		case hasOldest && (at.Before(oldestAt) || (!inclusive && at.Equal(oldestAt))):
+		default:
+			window = append(window, messages[i])
+		}
+	}
+	return window
+}
+
+// isTrue reports whether a boolean api parameter such as `inclusive` is set
+func isTrue(v string) bool {
+	return v == "1" || v == "true"
+}
+
+// writeHistory writes the page of `messages` selected by the `latest`, `oldest`, `inclusive` and `count`
+// parameters in `values`, most recent first like slack. `messages` must be oldest first
+func writeHistory(w http.ResponseWriter, messages []slack.Message, values url.Values) {
+	count := defaultHistoryCount
+	if c, err := strconv.Atoi(values.Get("count")); err == nil && c > 0 {
+		count = c
+	}
+	if count > maxHistoryCount {
+		count = maxHistoryCount
+	}
+	window := historyWindow(messages, values.Get("latest"), values.Get("oldest"), isTrue(values.Get("inclusive")))
+	hasMore := len(window) > count
+	if hasMore {
+		// slack returns the messages closest to latest, or to oldest when only oldest is given
+		if values.Get("oldest") != "" && values.Get("latest") == "" {
+			window = window[len(window)-count:]
+		} else {
+			window = window[:count]
+		}
+	}
+	resp := struct {
+		slack.WebResponse
+		slack.History
+	}{
+		WebResponse: okWebResponse,
+		History: slack.History{
+			Latest:   values.Get("latest"),
+			Messages: window,
+			HasMore:  hasMore,
+		},
+	}
+	writeJSON(w, resp)
+}
+
+// handle channels.history
+func channelsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	if _, found := s.channels.get(channel); !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	writeHistory(w, s.messages.history(channel), values)
+}
+
+// handle groups.history
+func groupsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	_, found := findGroup(s.GetGroups(), channel)
+	if !found {
+		// slack still serves multi-party direct messages from the groups.* methods
+		_, found = s.mpims.get(s.tokenUser(requestToken(r, values)), channel)
+	}
+	if !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	writeHistory(w, s.messages.history(channel), values)
+}
+
+// handle conversations.history
+func conversationsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	if _, found := s.conversation(s.tokenUser(requestToken(r, values)), channel); !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	limit := defaultHistoryCount
+	if l := values.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			writeSlackError(w, "invalid_limit")
+			return
+		}
+	}
+	if limit > maxHistoryCount {
+		limit = maxHistoryCount
+	}
+	latest := values.Get("latest")
+	inclusive := isTrue(values.Get("inclusive"))
+	if c := values.Get("cursor"); c != "" {
+		// the cursor points at the last message of the previous page
+		ts, err := decodeCursor("ts", c)
+		if err != nil {
+			writeSlackError(w, "invalid_cursor")
+			return
+		}
+		latest = ts
+		inclusive = false
+	}
+	window := historyWindow(s.messages.history(channel), latest, values.Get("oldest"), inclusive)
+	cursor := ""
+	if len(window) > limit {
+		window = window[:limit]
+		cursor = encodeCursor("ts", window[limit-1].Timestamp)
+	}
+	resp := struct {
+		slack.WebResponse
+		Messages         []slack.Message  `json:"messages"`
+		HasMore          bool             `json:"has_more"`
+		PinCount         int              `json:"pin_count"`
+		ResponseMetadata responseMetadata `json:"response_metadata"`
+	}{
+		WebResponse:      okWebResponse,
+		Messages:         window,
+		HasMore:          cursor != "",
+		ResponseMetadata: responseMetadata{NextCursor: cursor},
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,154 @@
+package slacktest
+
+import (
+	"net/url"
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func seededMessage(ts, text string) slack.Message {
+	m := slack.Message{}
+	m.Timestamp = ts
+	m.Text = text
+	m.User = defaultNonBotUserID
+	return m
+}
+
+func TestChannelsAndGroupsHistoryHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	s.SendMessageToChannel("C024BE91L", "live")
+	seeded := s.SeedHistory("C024BE91L",
+		seededMessage("1500000002.000000", "second"),
+		seededMessage("1500000001.000000", "first"),
+		seededMessage("1500000003.000000", "third"),
+	)
+	assert.Equal(t, []string{"1500000002.000000", "1500000001.000000", "1500000003.000000"}, seeded)
+	reply := seededMessage("1500000004.000000", "in a thread")
+	reply.ThreadTimestamp = "1500000001.000000"
+	s.SeedHistory("C024BE91L", reply)
+	assert.Empty(t, s.GetOutboundEvents(EventOfType("message_replied")), "seeding shouldn't notify clients")
+
+	history, err := client.GetChannelHistory("C024BE91L", slack.NewHistoryParameters())
+	if assert.NoError(t, err) && assert.Len(t, history.Messages, 4) {
+		assert.Equal(t, "live", history.Messages[0].Text)
+		assert.Equal(t, "third", history.Messages[1].Text)
+		assert.Equal(t, "first", history.Messages[3].Text)
+		assert.Equal(t, 1, history.Messages[3].ReplyCount)
+	}
+	params := slack.NewHistoryParameters()
+	params.Oldest = "1500000001.000000"
+	params.Latest = "1500000003.000000"
+	history, _ = client.GetChannelHistory("C024BE91L", params)
+	if assert.Len(t, history.Messages, 1) {
+		assert.Equal(t, "second", history.Messages[0].Text)
+	}
+	params.Inclusive = true
+	params.Count = 2
+	history, _ = client.GetChannelHistory("C024BE91L", params)
+	assert.Len(t, history.Messages, 2)
+	assert.True(t, history.HasMore)
+	_, err = client.GetChannelHistory("C000000", slack.NewHistoryParameters())
+	assert.EqualError(t, err, "channel_not_found")
+
+	s.SeedHistory("G024BE91L", seededMessage("1500000001.000000", "secret"))
+	groupHistory, err := client.GetGroupHistory("G024BE91L", slack.NewHistoryParameters())
+	if assert.NoError(t, err) && assert.Len(t, groupHistory.Messages, 1) {
+		assert.Equal(t, "secret", groupHistory.Messages[0].Text)
+	}
+	_, err = client.GetGroupHistory("C024BE91L", slack.NewHistoryParameters())
+	assert.EqualError(t, err, "channel_not_found")
+}
+
+func TestConversationsHistoryHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		s.SendMessageToChannel("C024BE91L", text)
+	}
+	type historyResponse struct {
+		slack.WebResponse
+		Messages         []slack.Message  `json:"messages"`
+		HasMore          bool             `json:"has_more"`
+		ResponseMetadata responseMetadata `json:"response_metadata"`
+	}
+	var seen []string
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		page := historyResponse{}
+		postDecode(t, s, "conversations.history", url.Values{"channel": {"C024BE91L"}, "limit": {"2"}, "cursor": {cursor}}, &page)
+		assert.True(t, page.Ok)
+		for _, m := range page.Messages {
+			seen = append(seen, m.Text)
+		}
+		cursor = page.ResponseMetadata.NextCursor
+		assert.Equal(t, cursor != "", page.HasMore)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"five", "four", "three", "two", "one"}, seen)
+
+	id, err := s.OpenIM(defaultNonBotUserID)
+	assert.NoError(t, err)
+	s.SendDirectMessageToBot("hello bot")
+	page := historyResponse{}
+	postDecode(t, s, "conversations.history", url.Values{"channel": {id}}, &page)
+	if assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, "hello bot", page.Messages[0].Text)
+	}
+	for slackErr, values := range map[string]url.Values{
+		"channel_not_found": {"channel": {"C000000"}},
+		"invalid_limit":     {"channel": {"C024BE91L"}, "limit": {"none"}},
+		"invalid_cursor":    {"channel": {"C024BE91L"}, "cursor": {"notacursor"}},
+	} {
+		failed := historyResponse{}
+		postDecode(t, s, "conversations.history", values, &failed)
+		assert.EqualError(t, failed.Error, slackErr)
+	}
+}
+
+func TestHistoryShortFractionBounds(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	s.SeedHistory("C024BE91L",
+		seededMessage("1500000001.000100", "too early"),
+		seededMessage("1500000001.600000", "in range"),
+		seededMessage("1500000002.000000", "too late"),
+	)
+	params := slack.NewHistoryParameters()
+	params.Oldest = "1500000001.5"
+	params.Latest = "1500000001.9"
+	history, err := slack.New("ABCDEFG").GetChannelHistory("C024BE91L", params)
+	if assert.NoError(t, err) && assert.Len(t, history.Messages, 1) {
+		assert.Equal(t, "in range", history.Messages[0].Text)
+	}
+}
+
+func TestHistoryHandlersUseTokenUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W0PAGER", Name: "pager"})
+	s.AddUser(slack.User{ID: "W0COMMANDER", Name: "commander"})
+	s.AddToken("xoxp-observer", "W0PAGER")
+	opened := mpimResponse{}
+	postDecode(t, s, "mpim.open", url.Values{"token": {"xoxp-observer"}, "users": {"W0COMMANDER," + defaultNonBotUserID}}, &opened)
+	if !assert.True(t, opened.Ok) {
+		t.FailNow()
+	}
+
+	for _, method := range []string{"groups.history", "conversations.history"} {
+		history := slack.WebResponse{}
+		postDecode(t, s, method, url.Values{"channel": {opened.Group.ID}}, &history)
+		assert.EqualError(t, history.Error, "channel_not_found", "the bot isn't a member")
+		history = slack.WebResponse{}
+		postDecode(t, s, method, url.Values{"token": {"xoxp-observer"}, "channel": {opened.Group.ID}}, &history)
+		assert.True(t, history.Ok, method)
+	}
+	s.Stop()
+}
@@ -0,0 +1,115 @@
+package slacktest
+
+import (
+	"net/http"
+
+	slack "github.com/nlopes/slack"
+)
+
+// handle im.open
+func imOpenHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	im, alreadyOpen, err := s.openIM(s.tokenUser(requestToken(r, values)), values.Get("user"), apiMethod(r))
+	if err != nil {
+		writeSlackError(w, "user_not_found")
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		NoOp        bool     `json:"no_op,omitempty"`
+		AlreadyOpen bool     `json:"already_open,omitempty"`
+		Channel     slack.IM `json:"channel"`
+	}{
+		WebResponse: okWebResponse,
+		NoOp:        alreadyOpen,
+		AlreadyOpen: alreadyOpen,
+		Channel:     im,
+	}
+	writeJSON(w, resp)
+}
+
+// handle im.close
+func imCloseHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	user := s.tokenUser(requestToken(r, values))
+	channel := values.Get("channel")
+	im, found := s.ims.get(user, channel)
+	if !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	_, alreadyClosed := s.ims.close(user, channel)
+	if !alreadyClosed {
+		queueEventForWebsocket(slack.IMCloseEvent{
+			Type:    "im_close",
+			User:    im.User,
+			Channel: channel,
+		}, s.ServerAddr, apiMethod(r))
+	}
+	resp := struct {
+		slack.WebResponse
+		NoOp          bool `json:"no_op,omitempty"`
+		AlreadyClosed bool `json:"already_closed,omitempty"`
+	}{
+		WebResponse:   okWebResponse,
+		NoOp:          alreadyClosed,
+		AlreadyClosed: alreadyClosed,
+	}
+	writeJSON(w, resp)
+}
+
+// handle im.list
+func imListHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		IMs []slack.IM `json:"ims"`
+	}{
+		WebResponse: okWebResponse,
+		IMs:         s.ims.forUser(s.tokenUser(requestToken(r, values))),
+	}
+	writeJSON(w, resp)
+}
+
+// handle im.history
+func imHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	if _, found := s.ims.get(s.tokenUser(requestToken(r, values)), channel); !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	writeHistory(w, s.messages.history(channel), values)
+}
+
+// handle im.mark
+func imMarkHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	ts := values.Get("ts")
+	if !s.ims.mark(s.tokenUser(requestToken(r, values)), channel, ts) {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	queueEventForWebsocket(slack.IMMarkedEvent{
+		Type:      "im_marked",
+		Channel:   channel,
+		Timestamp: ts,
+	}, s.ServerAddr, apiMethod(r))
+	writeJSON(w, okWebResponse)
+}
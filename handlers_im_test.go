@@ -0,0 +1,147 @@
+package slacktest
+
+import (
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIMOpenListAndCloseHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	s.AddUser(slack.User{ID: "W0NEWUSER", Name: "newuser"})
+
+	noOp, alreadyOpen, id, err := client.OpenIMChannel(defaultNonBotUserID)
+	assert.NoError(t, err)
+	assert.True(t, noOp)
+	assert.True(t, alreadyOpen)
+	assert.Equal(t, defaultIMID, id, "the default user should keep the default direct message channel")
+
+	_, alreadyOpen, newID, err := client.OpenIMChannel("W0NEWUSER")
+	assert.NoError(t, err)
+	assert.False(t, alreadyOpen)
+	assert.NotEqual(t, defaultIMID, newID)
+	_, _, again, _ := client.OpenIMChannel("W0NEWUSER")
+	assert.Equal(t, newID, again, "the same user should get the same channel")
+	assert.Len(t, s.GetOutboundEvents(EventOfType("im_created")), 1)
+	assert.Len(t, s.GetOutboundEvents(EventOfType("im_open")), 1)
+	_, _, _, err = client.OpenIMChannel("W000000")
+	assert.EqualError(t, err, "user_not_found")
+
+	ims, err := client.GetIMChannels()
+	if assert.NoError(t, err) && assert.Len(t, ims, 2) {
+		assert.Equal(t, defaultNonBotUserID, ims[0].User)
+		assert.Equal(t, "W0NEWUSER", ims[1].User)
+		assert.True(t, ims[1].IsOpen)
+	}
+
+	info, _, err := client.StartRTM()
+	if assert.NoError(t, err) {
+		assert.Len(t, info.IMs, 2, "rtm.start should include the bot's direct message channels")
+	}
+
+	noOp, alreadyClosed, err := client.CloseIMChannel(newID)
+	assert.NoError(t, err)
+	assert.False(t, noOp)
+	assert.False(t, alreadyClosed)
+	_, alreadyClosed, _ = client.CloseIMChannel(newID)
+	assert.True(t, alreadyClosed)
+	assert.Len(t, s.GetOutboundEvents(EventOfType("im_close")), 1)
+	_, _, err = client.CloseIMChannel("D000000")
+	assert.EqualError(t, err, "channel_not_found")
+	_, alreadyOpen, _, _ = client.OpenIMChannel("W0NEWUSER")
+	assert.False(t, alreadyOpen, "closed channels should be reopened")
+	assert.Len(t, s.GetOutboundEvents(EventOfType("im_open")), 2)
+}
+
+func TestIMHistoryAndMarkHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	s.AddUser(slack.User{ID: "W0NEWUSER", Name: "newuser"})
+	var sent []string
+	for _, text := range []string{"one", "two", "three"} {
+		ts, err := s.SendDirectMessageToBotFromUser("W0NEWUSER", text)
+		assert.NoError(t, err)
+		sent = append(sent, ts)
+	}
+	_, err := s.SendDirectMessageToBotFromUser("W000000", "nobody")
+	assert.EqualError(t, err, ErrUserNotFound.Error())
+	s.SendDirectMessageToBot("not in this channel")
+	id, err := s.OpenIM("W0NEWUSER")
+	assert.NoError(t, err)
+
+	params := slack.NewHistoryParameters()
+	history, err := client.GetIMHistory(id, params)
+	if assert.NoError(t, err) && assert.Len(t, history.Messages, 3) {
+		assert.Equal(t, "three", history.Messages[0].Text, "most recent messages come first")
+		assert.Equal(t, "W0NEWUSER", history.Messages[0].User)
+		assert.False(t, history.HasMore)
+	}
+	params.Count = 2
+	history, _ = client.GetIMHistory(id, params)
+	if assert.Len(t, history.Messages, 2) {
+		assert.Equal(t, "three", history.Messages[0].Text)
+		assert.True(t, history.HasMore)
+	}
+	params = slack.NewHistoryParameters()
+	params.Latest = sent[2]
+	history, _ = client.GetIMHistory(id, params)
+	assert.Len(t, history.Messages, 2, "latest is exclusive by default")
+	params.Inclusive = true
+	params.Oldest = sent[1]
+	history, _ = client.GetIMHistory(id, params)
+	assert.Len(t, history.Messages, 2)
+	_, err = client.GetIMHistory("D000000", slack.NewHistoryParameters())
+	assert.EqualError(t, err, "channel_not_found")
+
+	assert.NoError(t, client.MarkIMChannel(id, sent[1]))
+	ims := s.GetIMs()
+	if assert.Len(t, ims, 2) {
+		assert.Equal(t, sent[1], ims[1].LastRead)
+	}
+	assert.Len(t, s.GetOutboundEvents(EventOfType("im_marked")), 1)
+
+	_, _, err = client.PostMessage(id, "hello newuser", slack.PostMessageParameters{AsUser: true})
+	assert.NoError(t, err)
+	assert.True(t, s.BotSentDirectMessage("W0NEWUSER", "hello newuser"))
+	assert.False(t, s.BotSentDirectMessage(defaultNonBotUserID, "hello newuser"))
+}
+
+func TestIMHandlersUseTokenUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	s.AddUser(slack.User{ID: "W0NEWUSER", Name: "newuser"})
+	s.AddToken("xoxp-observer", defaultNonBotUserID)
+	observer := slack.New("xoxp-observer")
+	_, _, id, err := observer.OpenIMChannel("W0NEWUSER")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	ims, err := observer.GetIMChannels()
+	if assert.NoError(t, err) {
+		var users []string
+		for _, im := range ims {
+			users = append(users, im.User)
+		}
+		assert.Contains(t, users, "W0NEWUSER", "the token's user should see the channel they opened")
+	}
+	ims, err = slack.New("ABCDEFG").GetIMChannels()
+	if assert.NoError(t, err) {
+		for _, im := range ims {
+			assert.NotEqual(t, id, im.ID, "the bot shouldn't see another user's direct messages")
+		}
+	}
+	_, err = slack.New("ABCDEFG").GetIMHistory(id, slack.NewHistoryParameters())
+	assert.EqualError(t, err, "channel_not_found")
+	_, err = observer.GetIMHistory(id, slack.NewHistoryParameters())
+	assert.NoError(t, err)
+	_, _, err = observer.CloseIMChannel(id)
+	assert.NoError(t, err)
+	s.Stop()
+}
@@ -0,0 +1,82 @@
+package slacktest
+
+import (
+	"net/http"
+	"strings"
+
+	slack "github.com/nlopes/slack"
+)
+
+// splitUsers returns the ids in a comma separated `users` parameter
+func splitUsers(users string) []string {
+	var ids []string
+	for _, u := range strings.Split(users, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			ids = append(ids, u)
+		}
+	}
+	return ids
+}
+
+// mpimError returns the slack error for an error from openMPIM
+func mpimError(err error) string {
+	switch err {
+	case ErrNotEnoughUsers:
+		return "not_enough_users"
+	case ErrTooManyUsers:
+		return "too_many_users"
+	default:
+		return "user_not_found"
+	}
+}
+
+// handle mpim.open
+func mpimOpenHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	g, err := s.openMPIM(s.tokenUser(requestToken(r, values)), splitUsers(values.Get("users")), apiMethod(r))
+	if err != nil {
+		writeSlackError(w, mpimError(err))
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		Group mpimChannel `json:"group"`
+	}{
+		WebResponse: okWebResponse,
+		Group:       asMPIM(g),
+	}
+	writeJSON(w, resp)
+}
+
+// handle mpim.list
+func mpimListHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		Groups []mpimChannel `json:"groups"`
+	}{
+		WebResponse: okWebResponse,
+		Groups:      asMPIMs(s.mpims.forUser(s.tokenUser(requestToken(r, values)))),
+	}
+	writeJSON(w, resp)
+}
+
+// handle mpim.history
+func mpimHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	channel := values.Get("channel")
+	if _, found := s.mpims.get(s.tokenUser(requestToken(r, values)), channel); !found {
+		writeSlackError(w, "channel_not_found")
+		return
+	}
+	writeHistory(w, s.messages.history(channel), values)
+}
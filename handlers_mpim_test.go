@@ -0,0 +1,154 @@
+package slacktest
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+type mpimResponse struct {
+	slack.WebResponse
+	Group  mpimChannel   `json:"group"`
+	Groups []mpimChannel `json:"groups"`
+}
+
+func TestMPIMOpenAndListHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W0PAGER", Name: "pager"})
+	s.AddUser(slack.User{ID: "W0COMMANDER", Name: "commander"})
+
+	opened := mpimResponse{}
+	postDecode(t, s, "mpim.open", url.Values{"users": {"W0PAGER,W0COMMANDER"}}, &opened)
+	assert.True(t, opened.Ok)
+	assert.True(t, opened.Group.IsMpim)
+	assert.Equal(t, "mpdm-"+s.BotName+"--pager--commander-1", opened.Group.Name)
+	assert.Equal(t, []string{s.BotID, "W0PAGER", "W0COMMANDER"}, opened.Group.Members)
+	joined := s.GetOutboundEvents(EventOfType("mpim_joined"))
+	if assert.Len(t, joined, 1) {
+		evt := mpimJoinedEvent{}
+		assert.NoError(t, json.Unmarshal([]byte(joined[0].Raw), &evt))
+		assert.Equal(t, opened.Group.ID, evt.Channel.ID)
+	}
+
+	again := mpimResponse{}
+	postDecode(t, s, "mpim.open", url.Values{"users": {"W0COMMANDER, W0PAGER"}}, &again)
+	assert.Equal(t, opened.Group.ID, again.Group.ID, "the same users should get the same channel")
+	assert.Len(t, s.GetOutboundEvents(EventOfType("mpim_joined")), 1)
+
+	for users, slackErr := range map[string]string{
+		"W0PAGER":                    "not_enough_users",
+		"W0PAGER,W000000":            "user_not_found",
+		"W0PAGER,W0PAGER," + s.BotID: "not_enough_users",
+	} {
+		failed := mpimResponse{}
+		postDecode(t, s, "mpim.open", url.Values{"users": {users}}, &failed)
+		assert.EqualError(t, failed.Error, slackErr, users)
+	}
+
+	list := mpimResponse{}
+	postDecode(t, s, "mpim.list", url.Values{}, &list)
+	if assert.Len(t, list.Groups, 1) {
+		assert.Equal(t, opened.Group.ID, list.Groups[0].ID)
+	}
+	assert.Len(t, s.GetMPIMs(), 1)
+
+	info := fullInfoSlackResponse{}
+	postDecode(t, s, "rtm.start", url.Values{}, &info)
+	assert.Empty(t, info.MPIMs, "mpims are only sent to mpim_aware clients")
+	postDecode(t, s, "rtm.start", url.Values{"mpim_aware": {"1"}}, &info)
+	if assert.Len(t, info.MPIMs, 1) {
+		assert.Equal(t, opened.Group.ID, info.MPIMs[0].ID)
+	}
+}
+
+func TestMPIMHistoryAndConversationsOpenHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W0PAGER", Name: "pager"})
+	s.AddUser(slack.User{ID: "W0COMMANDER", Name: "commander"})
+	id, err := s.OpenMPIM("W0PAGER", "W0COMMANDER")
+	assert.NoError(t, err)
+	s.SendMessageToChannel(id, "incident declared")
+	s.SendMessageToChannel("C024BE91L", "somewhere else")
+
+	history := struct {
+		slack.WebResponse
+		slack.History
+	}{}
+	postDecode(t, s, "mpim.history", url.Values{"channel": {id}}, &history)
+	if assert.Len(t, history.Messages, 1) {
+		assert.Equal(t, "incident declared", history.Messages[0].Text)
+	}
+	postDecode(t, s, "mpim.history", url.Values{"channel": {"G000000"}}, &history)
+	assert.EqualError(t, history.Error, "channel_not_found")
+
+	type openResponse struct {
+		slack.WebResponse
+		AlreadyOpen bool            `json:"already_open"`
+		Channel     json.RawMessage `json:"channel"`
+	}
+	channel := struct {
+		ID     string `json:"id"`
+		IsMpim bool   `json:"is_mpim"`
+		IsIM   bool   `json:"is_im"`
+	}{}
+	opened := openResponse{}
+	postDecode(t, s, "conversations.open", url.Values{"users": {"W0PAGER,W0COMMANDER"}}, &opened)
+	assert.True(t, opened.Ok)
+	assert.NoError(t, json.Unmarshal(opened.Channel, &channel))
+	assert.Equal(t, id, channel.ID)
+	assert.True(t, channel.IsMpim)
+
+	opened = openResponse{}
+	postDecode(t, s, "conversations.open", url.Values{"users": {defaultNonBotUserID}}, &opened)
+	assert.True(t, opened.AlreadyOpen)
+	assert.JSONEq(t, `{"id":"`+defaultIMID+`"}`, string(opened.Channel))
+	postDecode(t, s, "conversations.open", url.Values{"users": {"W0PAGER"}, "return_im": {"true"}}, &opened)
+	assert.NoError(t, json.Unmarshal(opened.Channel, &channel))
+	assert.True(t, channel.IsIM)
+
+	postDecode(t, s, "conversations.open", url.Values{"channel": {id}}, &opened)
+	assert.NoError(t, json.Unmarshal(opened.Channel, &channel))
+	assert.Equal(t, id, channel.ID)
+	for slackErr, values := range map[string]url.Values{
+		"users_list_not_supplied": {},
+		"channel_not_found":       {"channel": {"G000000"}},
+		"user_not_found":          {"users": {"W000000"}},
+	} {
+		failed := openResponse{}
+		postDecode(t, s, "conversations.open", values, &failed)
+		assert.EqualError(t, failed.Error, slackErr)
+	}
+}
+
+func TestMPIMHandlersUseTokenUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W0PAGER", Name: "pager"})
+	s.AddUser(slack.User{ID: "W0COMMANDER", Name: "commander"})
+	s.AddToken("xoxp-observer", "W0PAGER")
+
+	opened := mpimResponse{}
+	postDecode(t, s, "mpim.open", url.Values{"token": {"xoxp-observer"}, "users": {"W0COMMANDER," + defaultNonBotUserID}}, &opened)
+	assert.True(t, opened.Ok)
+	assert.Equal(t, []string{"W0PAGER", "W0COMMANDER", defaultNonBotUserID}, opened.Group.Members, "the token's user should open the channel")
+
+	list := mpimResponse{}
+	postDecode(t, s, "mpim.list", url.Values{"token": {"xoxp-observer"}}, &list)
+	assert.Len(t, list.Groups, 1)
+	list = mpimResponse{}
+	postDecode(t, s, "mpim.list", url.Values{}, &list)
+	assert.Len(t, list.Groups, 0, "the bot isn't a member")
+
+	history := mpimResponse{}
+	postDecode(t, s, "mpim.history", url.Values{"channel": {opened.Group.ID}}, &history)
+	assert.EqualError(t, history.Error, "channel_not_found")
+	history = mpimResponse{}
+	postDecode(t, s, "mpim.history", url.Values{"token": {"xoxp-observer"}, "channel": {opened.Group.ID}}, &history)
+	assert.True(t, history.Ok)
+	s.Stop()
+}
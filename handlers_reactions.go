@@ -0,0 +1,125 @@
+package slacktest
+
+import (
+	"net/http"
+	"strconv"
+
+	slack "github.com/nlopes/slack"
+)
+
+const defaultReactionsListCount = 100
+
+// reactionSlackErrors maps the errors returned when reacting to the errors slack returns
+var reactionSlackErrors = map[error]string{
+	ErrMessageNotFound: "message_not_found",
+	ErrAlreadyReacted:  "already_reacted",
+	ErrNoReaction:      "no_reaction",
+	ErrInvalidReaction: "invalid_name",
+}
+
+// handle reactions.add
+func reactionsAddHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	err := s.addReaction(s.tokenUser(requestToken(r, values)), values.Get("channel"), values.Get("timestamp"), values.Get("name"), apiMethod(r))
+	if err != nil {
+		writeSlackError(w, reactionSlackErrors[err])
+		return
+	}
+	writeJSON(w, okWebResponse)
+}
+
+// handle reactions.remove
+func reactionsRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	err := s.removeReaction(s.tokenUser(requestToken(r, values)), values.Get("channel"), values.Get("timestamp"), values.Get("name"), apiMethod(r))
+	if err != nil {
+		writeSlackError(w, reactionSlackErrors[err])
+		return
+	}
+	writeJSON(w, okWebResponse)
+}
+
+// handle reactions.get
+func reactionsGetHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	m, found := s.messages.get(values.Get("channel"), values.Get("timestamp"))
+	if !found {
+		writeSlackError(w, "message_not_found")
+		return
+	}
+	resp := struct {
+		slack.WebResponse
+		Type    string        `json:"type"`
+		Channel string        `json:"channel"`
+		Message slack.Message `json:"message"`
+	}{
+		WebResponse: okWebResponse,
+		Type:        slack.TYPE_MESSAGE,
+		Channel:     m.Channel,
+		Message:     m,
+	}
+	writeJSON(w, resp)
+}
+
+// handle reactions.list
+func reactionsListHandler(w http.ResponseWriter, r *http.Request) {
+	s, values, ok := serverAndValues(w, r)
+	if !ok {
+		return
+	}
+	user := values.Get("user")
+	if user == "" {
+		user = s.tokenUser(requestToken(r, values))
+	}
+	count := defaultReactionsListCount
+	if c, err := strconv.Atoi(values.Get("count")); err == nil && c > 0 {
+		count = c
+	}
+	page := 1
+	if p, err := strconv.Atoi(values.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	// slack lists the most recent reactions first
+	messages := s.messages.reactedBy(user)
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	type reactedItem struct {
+		Type    string        `json:"type"`
+		Channel string        `json:"channel"`
+		Message slack.Message `json:"message"`
+	}
+	items := []reactedItem{}
+	start := (page - 1) * count
+	for i := start; i < len(messages) && i < start+count; i++ {
+		items = append(items, reactedItem{
+			Type:    slack.TYPE_MESSAGE,
+			Channel: messages[i].Channel,
+			Message: messages[i],
+		})
+	}
+	resp := struct {
+		slack.WebResponse
+		Items  []reactedItem `json:"items"`
+		Paging slack.Paging  `json:"paging"`
+	}{
+		WebResponse: okWebResponse,
+		Items:       items,
+		Paging: slack.Paging{
+			Count: count,
+			Total: len(messages),
+			Page:  page,
+			Pages: (len(messages) + count - 1) / count,
+		},
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,98 @@
+package slacktest
+
+import (
+	"testing"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReactionsAddAndRemoveHandlers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	ts := s.SendMessageToChannel("C024BE92L", "please approve")
+	ref := slack.NewRefToMessage("C024BE92L", ts)
+	assert.NoError(t, client.AddReaction("white_check_mark", ref))
+	assert.True(t, s.BotReacted("C024BE92L", ts, ":white_check_mark:"))
+	assert.EqualError(t, client.AddReaction("white_check_mark", ref), "already_reacted")
+	assert.EqualError(t, client.AddReaction("white_check_mark", slack.NewRefToMessage("C024BE92L", "1.000000")), "message_not_found")
+	assert.True(t, waitForOutboundType(s, "reaction_added"), "should have sent reaction_added")
+	assert.NoError(t, client.RemoveReaction("white_check_mark", ref))
+	assert.False(t, s.BotReacted("C024BE92L", ts, "white_check_mark"))
+	assert.EqualError(t, client.RemoveReaction("white_check_mark", ref), "no_reaction")
+	assert.True(t, waitForOutboundType(s, "reaction_removed"), "should have sent reaction_removed")
+}
+
+func TestReactionsGetHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	ts := s.SendMessageToChannel("C024BE92L", "incident!")
+	assert.NoError(t, s.AddReactionAsUser("W012A3CDE", "C024BE92L", ts, "rotating_light"))
+	assert.NoError(t, client.AddReaction("rotating_light", slack.NewRefToMessage("C024BE92L", ts)))
+	reactions, err := client.GetReactions(slack.NewRefToMessage("C024BE92L", ts), slack.NewGetReactionsParameters())
+	assert.NoError(t, err)
+	if assert.Len(t, reactions, 1) {
+		assert.Equal(t, "rotating_light", reactions[0].Name)
+		assert.Equal(t, 2, reactions[0].Count)
+		assert.Equal(t, []string{"W012A3CDE", s.BotID}, reactions[0].Users)
+	}
+	assert.NoError(t, s.RemoveReactionAsUser("W012A3CDE", "C024BE92L", ts, "rotating_light"))
+	reactions, err = s.GetReactions("C024BE92L", ts)
+	assert.NoError(t, err)
+	if assert.Len(t, reactions, 1) {
+		assert.Equal(t, 1, reactions[0].Count)
+	}
+	assert.EqualError(t, s.RemoveReactionAsUser("W012A3CDE", "C024BE92L", ts, "rotating_light"), ErrNoReaction.Error())
+}
+
+func TestReactionsListHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	first := s.SendMessageToChannel("C024BE92L", "first")
+	second := s.SendMessageToChannel("C024BE91L", "second")
+	assert.NoError(t, client.AddReaction("eyes", slack.NewRefToMessage("C024BE92L", first)))
+	assert.NoError(t, client.AddReaction("eyes", slack.NewRefToMessage("C024BE91L", second)))
+	items, paging, err := client.ListReactions(slack.NewListReactionsParameters())
+	assert.NoError(t, err)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, "C024BE91L", items[0].Channel)
+		assert.Equal(t, "second", items[0].Message.Text)
+		assert.Equal(t, "C024BE92L", items[1].Channel)
+	}
+	assert.Equal(t, 2, paging.Total)
+	params := slack.NewListReactionsParameters()
+	params.User = "W012A3CDE"
+	items, _, err = client.ListReactions(params)
+	assert.NoError(t, err)
+	assert.Len(t, items, 0)
+}
+
+func TestReactionsUseTokenUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	s.AddToken("xoxp-observer", "W012A3CDE")
+	client := slack.New("xoxp-observer")
+	ts := s.SendMessageToChannel("C024BE92L", "ship it?")
+	ref := slack.NewRefToMessage("C024BE92L", ts)
+	assert.NoError(t, client.AddReaction("shipit", ref))
+	reactions, err := s.GetReactions("C024BE92L", ts)
+	if assert.NoError(t, err) && assert.Len(t, reactions, 1) {
+		assert.Equal(t, []string{"W012A3CDE"}, reactions[0].Users)
+	}
+	assert.False(t, s.BotReacted("C024BE92L", ts, "shipit"), "the reaction should be the token's user's")
+	items, _, err := client.ListReactions(slack.NewListReactionsParameters())
+	assert.NoError(t, err)
+	assert.Len(t, items, 1, "reactions.list should default to the token's user")
+	assert.NoError(t, client.RemoveReaction("shipit", ref))
+	reactions, err = s.GetReactions("C024BE92L", ts)
+	assert.NoError(t, err)
+	assert.Len(t, reactions, 0)
+	s.Stop()
+}
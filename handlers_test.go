@@ -1,6 +1,9 @@
 package slacktest
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/url"
 	"testing"
 
 	slack "github.com/nlopes/slack"
@@ -38,11 +41,183 @@ func TestUserInfoHandler(t *testing.T) {
 	go s.Start()
 	slack.SLACK_API = s.GetAPIURL()
 	client := slack.New("ABCDEFG")
-	user, err := client.GetUserInfo("123456")
+	user, err := client.GetUserInfo("W012A3CDE")
 	assert.NoError(t, err)
 	assert.Equal(t, "W012A3CDE", user.ID)
 	assert.Equal(t, "spengler", user.Name)
 	assert.True(t, user.IsAdmin)
+	_, err = client.GetUserInfo("123456")
+	assert.EqualError(t, err, "user_not_found")
+}
+
+func TestUserInfoHandlerAddedUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{
+		ID:           "W999999",
+		Name:         "venkman",
+		Deleted:      true,
+		IsRestricted: true,
+		Profile:      slack.UserProfile{Email: "venkman@ghostbusters.example.com"},
+	})
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	user, err := client.GetUserInfo("W999999")
+	assert.NoError(t, err)
+	assert.Equal(t, "venkman", user.Name)
+	assert.True(t, user.Deleted)
+	assert.True(t, user.IsRestricted)
+	assert.Equal(t, "venkman@ghostbusters.example.com", user.Profile.Email)
+	bot, err := client.GetUserInfo(s.BotID)
+	assert.NoError(t, err)
+	assert.True(t, bot.IsBot)
+}
+
+func TestUsersListHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W999999", Name: "venkman"})
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	users, err := client.GetUsers()
+	assert.NoError(t, err)
+	if !assert.Len(t, users, 3) {
+		t.FailNow()
+	}
+	assert.Equal(t, "W012A3CDE", users[0].ID)
+	assert.Equal(t, s.BotID, users[1].ID)
+	assert.Equal(t, "W999999", users[2].ID)
+}
+
+func TestUsersListHandlerPagination(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W999999", Name: "venkman"})
+	type usersList struct {
+		Ok               bool         `json:"ok"`
+		Error            string       `json:"error"`
+		Members          []slack.User `json:"members"`
+		ResponseMetadata struct {
+			NextCursor string `json:"next_cursor"`
+		} `json:"response_metadata"`
+	}
+	var seen []string
+	cursor := ""
+	for i := 0; i < 3; i++ {
+		resp, err := http.PostForm(s.GetAPIURL()+"users.list", url.Values{"limit": {"2"}, "cursor": {cursor}})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		page := usersList{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		_ = resp.Body.Close()
+		assert.True(t, page.Ok)
+		for _, u := range page.Members {
+			seen = append(seen, u.ID)
+		}
+		cursor = page.ResponseMetadata.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"W012A3CDE", s.BotID, "W999999"}, seen)
+	resp, err := http.PostForm(s.GetAPIURL()+"users.list", url.Values{"cursor": {"notacursor"}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	page := usersList{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	_ = resp.Body.Close()
+	assert.False(t, page.Ok)
+	assert.Equal(t, "invalid_cursor", page.Error)
+}
+
+func TestUsersListHandlerWithoutLimit(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddUser(slack.User{ID: "W999999", Name: "venkman"})
+	type usersList struct {
+		Ok               bool         `json:"ok"`
+		Members          []slack.User `json:"members"`
+		ResponseMetadata struct {
+			NextCursor string `json:"next_cursor"`
+		} `json:"response_metadata"`
+	}
+	for _, values := range []url.Values{{}, {"limit": {"0"}}} {
+		page := usersList{}
+		postDecode(t, s, "users.list", values, &page)
+		assert.True(t, page.Ok)
+		assert.Len(t, page.Members, 3, "every user should be on one page with %v", values)
+		assert.Empty(t, page.ResponseMetadata.NextCursor, "there should be no next page with %v", values)
+	}
+}
+
+func TestUsersGetPresenceHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	assert.NoError(t, s.SetUserPresence("W012A3CDE", "away"))
+	assert.EqualError(t, s.SetUserPresence("W999999", "away"), ErrUserNotFound.Error())
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	presence, err := client.GetUserPresence("W012A3CDE")
+	assert.NoError(t, err)
+	assert.Equal(t, "away", presence.Presence)
+	assert.False(t, presence.Online)
+	presence, err = client.GetUserPresence(s.BotID)
+	assert.NoError(t, err)
+	assert.Equal(t, "active", presence.Presence)
+	_, err = client.GetUserPresence("W999999")
+	assert.EqualError(t, err, "user_not_found")
+}
+
+func TestUsersProfileGetHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	type profileResponse struct {
+		Ok      bool              `json:"ok"`
+		Error   string            `json:"error"`
+		Profile slack.UserProfile `json:"profile"`
+	}
+	resp, err := http.PostForm(s.GetAPIURL()+"users.profile.get", url.Values{"user": {"W012A3CDE"}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	profile := profileResponse{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&profile))
+	_ = resp.Body.Close()
+	assert.True(t, profile.Ok)
+	assert.Equal(t, "spengler@ghostbusters.example.com", profile.Profile.Email)
+	resp, err = http.PostForm(s.GetAPIURL()+"users.profile.get", url.Values{"user": {"W999999"}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	profile = profileResponse{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&profile))
+	_ = resp.Body.Close()
+	assert.False(t, profile.Ok)
+	assert.Equal(t, "user_not_found", profile.Error)
+}
+
+func TestUserInfoHandlerCustomDefaultUser(t *testing.T) {
+	s := NewTestServer(WithDefaultUser(slack.User{ID: "W999999", Name: "venkman"}))
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	user, err := client.GetUserInfo("W999999")
+	assert.NoError(t, err)
+	assert.Equal(t, "W999999", user.ID)
+	assert.Equal(t, "venkman", user.Name)
+}
+
+func TestBotInfoHandlerCustomBot(t *testing.T) {
+	s := NewTestServer(WithBotID("U1234567890"), WithBotName("BobsBot"))
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	bot, err := client.GetBotInfo("U1234567890")
+	assert.NoError(t, err)
+	assert.Equal(t, "U1234567890", bot.ID)
+	assert.Equal(t, "BobsBot", bot.Name)
 }
 
 func TestBotInfoHandler(t *testing.T) {
@@ -94,3 +269,62 @@ func TestListChannelsHandler(t *testing.T) {
 	assert.Equal(t, "Fun times", otherChan.Topic.Value)
 	assert.True(t, otherChan.IsMember, "should be in channel")
 }
+
+func TestListChannelsHandlerAddedChannel(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	c := slack.Channel{}
+	c.ID = "C1234567890"
+	c.Name = "ops"
+	c.Members = []string{"W012A3CDE", s.BotID}
+	s.AddChannel(c)
+	assert.NoError(t, s.RemoveChannel("C024BE91L"))
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channels, err := client.GetChannels(true)
+	assert.NoError(t, err)
+	if !assert.Len(t, channels, 2, "should have two channels") {
+		t.FailNow()
+	}
+	assert.Equal(t, "C024BE92L", channels[0].ID)
+	assert.Equal(t, "C1234567890", channels[1].ID)
+	assert.Equal(t, []string{"W012A3CDE", s.BotID}, channels[1].Members)
+}
+
+func TestChannelsInfoHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	assert.NoError(t, s.SetChannelTopic("C024BE92L", "new topic"))
+	assert.NoError(t, s.SetChannelPurpose("C024BE92L", "new purpose"))
+	assert.NoError(t, s.SetChannelMembers("C024BE92L", []string{"W012A3CDE", "W999999"}))
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	channel, err := client.GetChannelInfo("C024BE92L")
+	assert.NoError(t, err)
+	assert.Equal(t, "bot-playground", channel.Name)
+	assert.Equal(t, "new topic", channel.Topic.Value)
+	assert.Equal(t, "new purpose", channel.Purpose.Value)
+	assert.Equal(t, []string{"W012A3CDE", "W999999"}, channel.Members)
+	_, err = client.GetChannelInfo("C999999999")
+	assert.EqualError(t, err, "channel_not_found")
+}
+
+func TestGroupsInfoHandler(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	g := slack.Group{}
+	g.ID = "G1234567890"
+	g.Name = "moreplans"
+	g.IsGroup = true
+	s.AddGroup(g)
+	assert.NoError(t, s.SetChannelTopic("G1234567890", "plans"))
+	slack.SLACK_API = s.GetAPIURL()
+	client := slack.New("ABCDEFG")
+	group, err := client.GetGroupInfo("G1234567890")
+	assert.NoError(t, err)
+	assert.Equal(t, "moreplans", group.Name)
+	assert.Equal(t, "plans", group.Topic.Value)
+	assert.NoError(t, s.RemoveGroup("G1234567890"))
+	_, err = client.GetGroupInfo("G1234567890")
+	assert.EqualError(t, err, "channel_not_found")
+}
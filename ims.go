@@ -0,0 +1,223 @@
+package slacktest
+
+import (
+	"sync"
+
+	slack "github.com/nlopes/slack"
+)
+
+// defaultIMID is the direct message channel between the default user and the bot
+const defaultIMID = "D024BE91L"
+
+// storedIM is a direct message channel between two users
+type storedIM struct {
+	id      string
+	members [2]string
+	created slack.JSONTime
+	// open and lastRead are tracked for each member
+	open     map[string]bool
+	lastRead map[string]string
+}
+
+type serverIMs struct {
+	sync.RWMutex
+	ims []*storedIM
+}
+
+func newStoredIM(id, user, other string) *storedIM {
+	return &storedIM{
+		id:       id,
+		members:  [2]string{user, other},
+		created:  nowAsJSONTime(),
+		open:     map[string]bool{user: true, other: true},
+		lastRead: make(map[string]string),
+	}
+}
+
+// other returns the member of `im` that isn't `user`
+func (im *storedIM) other(user string) string {
+	if im.members[0] == user {
+		return im.members[1]
+	}
+	return im.members[0]
+}
+
+func (im *storedIM) hasMember(user string) bool {
+	return im.members[0] == user || im.members[1] == user
+}
+
+// view returns `im` as seen by `user`
+func (im *storedIM) view(user string) slack.IM {
+	v := slack.IM{IsIM: true, User: im.other(user)}
+	v.ID = im.id
+	v.Created = im.created
+	v.IsOpen = im.open[user]
+	v.LastRead = im.lastRead[user]
+	return v
+}
+
+// find returns the channel between `user` and `other`. Callers must hold the lock
+func (si *serverIMs) find(user, other string) *storedIM {
+	for _, im := range si.ims {
+		if im.hasMember(user) && im.other(user) == other {
+			return im
+		}
+	}
+	return nil
+}
+
+// byID returns the channel `id` if `user` is a member of it. Callers must hold the lock
+func (si *serverIMs) byID(user, id string) *storedIM {
+	for _, im := range si.ims {
+		if im.id == id && im.hasMember(user) {
+			return im
+		}
+	}
+	return nil
+}
+
+// add creates the channel `id` between `user` and `other` unless they already have one
+func (si *serverIMs) add(id, user, other string) {
+	si.Lock()
+	defer si.Unlock()
+	if si.find(user, other) == nil {
+		si.ims = append(si.ims, newStoredIM(id, user, other))
+	}
+}
+
+// open opens the channel between `user` and `other` for `user`, creating it if needed.
+// It reports whether the channel was created and whether it was already open
+func (si *serverIMs) open(user, other string) (im slack.IM, created, alreadyOpen bool) {
+	si.Lock()
+	defer si.Unlock()
+	stored := si.find(user, other)
+	if stored == nil {
+		stored = newStoredIM(newID("D"), user, other)
+		si.ims = append(si.ims, stored)
+		return stored.view(user), true, false
+	}
+	alreadyOpen = stored.open[user]
+	stored.open[user] = true
+	return stored.view(user), false, alreadyOpen
+}
+
+// close closes the channel `id` for `user`. It reports whether the channel was found and whether it was already closed
+func (si *serverIMs) close(user, id string) (found, alreadyClosed bool) {
+	si.Lock()
+	defer si.Unlock()
+	stored := si.byID(user, id)
+	if stored == nil {
+		return false, false
+	}
+	alreadyClosed = !stored.open[user]
+	stored.open[user] = false
+	return true, alreadyClosed
+}
+
+// mark moves the read cursor of `user` in the channel `id` to `ts`
+func (si *serverIMs) mark(user, id, ts string) bool {
+	si.Lock()
+	defer si.Unlock()
+	stored := si.byID(user, id)
+	if stored == nil {
+		return false
+	}
+	stored.lastRead[user] = ts
+	return true
+}
+
+// get returns the channel `id` as seen by `user`
+func (si *serverIMs) get(user, id string) (slack.IM, bool) {
+	si.RLock()
+	defer si.RUnlock()
+	stored := si.byID(user, id)
+	if stored == nil {
+		return slack.IM{}, false
+	}
+	return stored.view(user), true
+}
+
+// forUser returns the channels `user` is a member of, oldest first
+func (si *serverIMs) forUser(user string) []slack.IM {
+	si.RLock()
+	defer si.RUnlock()
+	ims := []slack.IM{}
+	for _, im := range si.ims {
+		if im.hasMember(user) {
+			ims = append(ims, im.view(user))
+		}
+	}
+	return ims
+}
+
+// openIM opens the direct message channel between `user` and `other` for `user` and notifies connected clients.
+// `source` is recorded against the resulting events
+func (sts *Server) openIM(user, other, source string) (slack.IM, bool, error) {
+	if _, ok := findUser(sts.GetUsers(), other); !ok {
+		return slack.IM{}, false, ErrUserNotFound
+	}
+	im, created, alreadyOpen := sts.ims.open(user, other)
+	if created {
+		queueEventForWebsocket(slack.IMCreatedEvent{
+			Type: "im_created",
+			User: other,
+			Channel: slack.ChannelCreatedInfo{
+				ID:      im.ID,
+				Created: int(im.Created),
+				Creator: user,
+			},
+		}, sts.ServerAddr, source)
+	}
+	if !alreadyOpen {
+		queueEventForWebsocket(slack.IMOpenEvent{
+			Type:    "im_open",
+			User:    other,
+			Channel: im.ID,
+		}, sts.ServerAddr, source)
+	}
+	return im, alreadyOpen, nil
+}
+
+// GetIMs returns the bot's direct message channels
+func (sts *Server) GetIMs() []slack.IM {
+	return sts.ims.forUser(sts.BotID)
+}
+
+// OpenIM opens a direct message channel between the bot and `user` and returns its id.
+// The same user always gets the same channel
+func (sts *Server) OpenIM(user string) (string, error) {
+	im, _, err := sts.openIM(sts.BotID, user, SourceServer)
+	return im.ID, err
+}
+
+// SendDirectMessageToBotFromUser sends a direct message from `user` to the bot and returns its timestamp.
+// `user` must be a registered user
+func (sts *Server) SendDirectMessageToBotFromUser(user, msg string) (string, error) {
+	channel, err := sts.OpenIM(user)
+	if err != nil {
+		return "", err
+	}
+	m := slack.Message{}
+	m.Type = slack.TYPE_MESSAGE
+	m.Channel = channel
+	m.User = user
+	m.Text = msg
+	m.Timestamp = newTimestamp()
+	return sts.sendUserMessage(m), nil
+}
+
+// BotSentDirectMessage checks if the bot sent `msg` to `user` in their direct message channel
+func (sts *Server) BotSentDirectMessage(user, msg string) bool {
+	sts.ims.RLock()
+	stored := sts.ims.find(sts.BotID, user)
+	sts.ims.RUnlock()
+	if stored == nil {
+		return false
+	}
+	for _, m := range sts.messages.postedBy(stored.id, sts.BotID) {
+		if m.Text == msg {
+			return true
+		}
+	}
+	return false
+}
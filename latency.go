@@ -0,0 +1,119 @@
+package slacktest
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Latency returns how long to delay a single call or message.
+// Any function can be used to supply your own distribution
+type Latency func() time.Duration
+
+// FixedLatency delays every call or message by `d`
+func FixedLatency(d time.Duration) Latency {
+	return func() time.Duration {
+		return d
+	}
+}
+
+// UniformLatency delays calls or messages by a random duration between `min` and `max`.
+// The same `seed` always produces the same sequence of delays
+func UniformLatency(min, max time.Duration, seed int64) Latency {
+	var lock sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func() time.Duration {
+		if max <= min {
+			return min
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		return min + time.Duration(r.Int63n(int64(max-min)+1))
+	}
+}
+
+type serverLatencies struct {
+	sync.RWMutex
+	// api is keyed by Web API method with "" applying to every other method
+	api       map[string]Latency
+	websocket map[Direction]Latency
+}
+
+func newServerLatencies() *serverLatencies {
+	return &serverLatencies{
+		api:       make(map[string]Latency),
+		websocket: make(map[Direction]Latency),
+	}
+}
+
+// delay sleeps for the duration returned by `l` if any
+func (l Latency) delay() {
+	if l == nil {
+		return
+	}
+	if d := l(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (sl *serverLatencies) forMethod(method string) Latency {
+	sl.RLock()
+	defer sl.RUnlock()
+	if l, ok := sl.api[method]; ok {
+		return l
+	}
+	return sl.api[""]
+}
+
+func (sl *serverLatencies) forDirection(d Direction) Latency {
+	if sl == nil {
+		return nil
+	}
+	sl.RLock()
+	defer sl.RUnlock()
+	return sl.websocket[d]
+}
+
+// latencyHandler delays calls to `next` by the latency set for the method.
+// The websocket endpoint uses the per direction latencies instead and file downloads aren't delayed
+func latencyHandler(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAPIRequest(r) {
+			s.latencies.forMethod(apiMethod(r)).delay()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetAPILatency delays every call to `method` by `l`.
+// An empty `method` applies to every method without its own latency, and a nil `l` removes the latency
+func (sts *Server) SetAPILatency(method string, l Latency) {
+	sts.latencies.Lock()
+	defer sts.latencies.Unlock()
+	if l == nil {
+		delete(sts.latencies.api, method)
+		return
+	}
+	sts.latencies.api[method] = l
+}
+
+// SetWebsocketLatency delays every websocket message travelling in direction `d` by `l`.
+// Messages in the same direction are still delivered in order. A nil `l` removes the latency
+func (sts *Server) SetWebsocketLatency(d Direction, l Latency) {
+	sts.latencies.Lock()
+	defer sts.latencies.Unlock()
+	if l == nil {
+		delete(sts.latencies.websocket, d)
+		return
+	}
+	sts.latencies.websocket[d] = l
+}
+
+// ClearLatency removes every latency set on the server
+func (sts *Server) ClearLatency() {
+	sts.latencies.Lock()
+	sts.latencies.api = make(map[string]Latency)
+	sts.latencies.websocket = make(map[Direction]Latency)
+	sts.latencies.Unlock()
+}
@@ -0,0 +1,80 @@
+package slacktest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniformLatencyIsDeterministic(t *testing.T) {
+	a := UniformLatency(10*time.Millisecond, 20*time.Millisecond, 42)
+	b := UniformLatency(10*time.Millisecond, 20*time.Millisecond, 42)
+	for i := 0; i < 10; i++ {
+		d := a()
+		assert.Equal(t, d, b(), "same seed should produce the same delays")
+		assert.True(t, d >= 10*time.Millisecond && d <= 20*time.Millisecond, "delay should be within bounds")
+	}
+	assert.Equal(t, 5*time.Millisecond, UniformLatency(5*time.Millisecond, time.Millisecond, 1)())
+}
+
+func TestSetAPILatency(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.SetAPILatency("users.info", FixedLatency(50*time.Millisecond))
+	s.SetAPILatency("", func() time.Duration { return 20 * time.Millisecond })
+	for _, method := range []string{"users.info", "users.list", "users.getPresence"} {
+		resp, err := http.PostForm(s.GetAPIURL()+method, url.Values{"user": {"W012A3CDE"}})
+		if assert.NoError(t, err) {
+			_ = resp.Body.Close()
+		}
+	}
+	info, _ := s.LastAPICall("users.info")
+	assert.True(t, info.Duration >= 50*time.Millisecond, "users.info should be delayed by its own latency")
+	list, _ := s.LastAPICall("users.list")
+	assert.True(t, list.Duration >= 20*time.Millisecond, "other methods should use the default latency")
+	assert.True(t, list.Duration < 50*time.Millisecond)
+
+	s.SetAPILatency("users.info", nil)
+	s.ClearLatency()
+	resp, err := http.PostForm(s.GetAPIURL()+"users.info", url.Values{"user": {"W012A3CDE"}})
+	if assert.NoError(t, err) {
+		_ = resp.Body.Close()
+	}
+	info, _ = s.LastAPICall("users.info")
+	assert.True(t, info.Duration < 20*time.Millisecond, "latency should be cleared")
+	s.Stop()
+}
+
+func TestSetWebsocketLatency(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.SetWebsocketLatency(DirectionOutbound, FixedLatency(50*time.Millisecond))
+	slack.SLACK_API = s.GetAPIURL()
+	api := slack.New("ABCDEFG")
+	rtm := api.NewRTM()
+	go rtm.ManageConnection()
+	received := make(chan time.Time, 2)
+	go func() {
+		for msg := range rtm.IncomingEvents {
+			if ev, ok := msg.Data.(*slack.MessageEvent); ok && ev.Text == t.Name() {
+				received <- time.Now()
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sent := time.Now()
+	s.SendMessageToChannel("C024BE91L", t.Name())
+	select {
+	case at := <-received:
+		assert.True(t, at.Sub(sent) >= 50*time.Millisecond, "message should be delayed")
+	case <-ctx.Done():
+		assert.FailNow(t, "did not get message in time")
+	}
+	s.Stop()
+}
@@ -0,0 +1,222 @@
+package slacktest
+
+import (
+	"encoding/json"
+	"sort"
+
+	slack "github.com/nlopes/slack"
+)
+
+// copyMessage returns a copy of `m` that doesn't share its slices with the original
+func copyMessage(m slack.Message) slack.Message {
+	m.Attachments = append([]slack.Attachment(nil), m.Attachments...)
+	m.Replies = append([]slack.Reply(nil), m.Replies...)
+	m.Reactions = append([]slack.ItemReaction(nil), m.Reactions...)
+	for i := range m.Reactions {
+		m.Reactions[i].Users = append([]string(nil), m.Reactions[i].Users...)
+	}
+	return m
+}
+
+func (sm *serverMessages) add(m slack.Message, postedBy string) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.messages = append(sm.messages, &storedMessage{
+		message:  copyMessage(m),
+		postedBy: postedBy,
+	})
+}
+
+// find returns the stored message for `channel` and `ts`. Callers must hold the lock
+func (sm *serverMessages) find(channel, ts string) (int, *storedMessage) {
+	for i, m := range sm.messages {
+		if m.message.Channel == channel && m.message.Timestamp == ts {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+func (sm *serverMessages) get(channel, ts string) (slack.Message, bool) {
+	sm.RLock()
+	defer sm.RUnlock()
+	_, m := sm.find(channel, ts)
+	if m == nil {
+		return slack.Message{}, false
+	}
+	return copyMessage(m.message), true
+}
+
+// update calls `f` with the message matching `channel` and `ts` while holding the lock
+func (sm *serverMessages) update(channel, ts string, f func(*storedMessage)) bool {
+	sm.Lock()
+	defer sm.Unlock()
+	_, m := sm.find(channel, ts)
+	if m == nil {
+		return false
+	}
+	f(m)
+	return true
+}
+
+// remove deletes the message matching `channel` and `ts` if `allow` returns true for it
+func (sm *serverMessages) remove(channel, ts string, allow func(*storedMessage) bool) (slack.Message, bool) {
+	sm.Lock()
+	defer sm.Unlock()
+	i, m := sm.find(channel, ts)
+	if m == nil || !allow(m) {
+		return slack.Message{}, false
+	}
+	sm.messages = append(sm.messages[:i], sm.messages[i+1:]...)
+	return m.message, true
+}
+
+func (sm *serverMessages) edits(channel, ts string) ([]slack.Message, bool) {
+	sm.RLock()
+	defer sm.RUnlock()
+	_, m := sm.find(channel, ts)
+	if m == nil {
+		return nil, false
+	}
+	edits := make([]slack.Message, 0, len(m.edits))
+	for _, e := range m.edits {
+		edits = append(edits, copyMessage(e))
+	}
+	return edits, true
+}
+
+// postedBy returns the messages `user` posted to `channel`, oldest first
+func (sm *serverMessages) postedBy(channel, user string) []slack.Message {
+	sm.RLock()
+	defer sm.RUnlock()
+	var messages []slack.Message
+	for _, m := range sm.messages {
+		if m.message.Channel == channel && m.postedBy == user {
+			messages = append(messages, copyMessage(m.message))
+		}
+	}
+	return messages
+}
+
+// history returns the messages in `channel` outside of threads, oldest first.
+// Thread replies are included when they were also sent to the channel
+func (sm *serverMessages) history(channel string) []slack.Message {
+	sm.RLock()
+	defer sm.RUnlock()
+	var messages []slack.Message
+	for _, m := range sm.messages {
+		if m.message.Channel != channel {
+			continue
+		}
+		isReply := m.message.ThreadTimestamp != "" && m.message.ThreadTimestamp != m.message.Timestamp
+		if !isReply || m.message.SubType == "thread_broadcast" {
+			messages = append(messages, copyMessage(m.message))
+		}
+	}
+	// seeded messages can be older than the ones already seen
+	sort.SliceStable(messages, func(i, j int) bool {
+		return timestampBefore(messages[i].Timestamp, messages[j].Timestamp)
+	})
+	return messages
+}
+
+// thread returns the parent message of a thread followed by its replies
+func (sm *serverMessages) thread(channel, threadTS string) ([]slack.Message, bool) {
+	sm.RLock()
+	defer sm.RUnlock()
+	_, parent := sm.find(channel, threadTS)
+	if parent == nil {
+		return nil, false
+	}
+	messages := []slack.Message{copyMessage(parent.message)}
+	for _, m := range sm.messages {
+		if m.message.Channel == channel && m.message.ThreadTimestamp == threadTS && m.message.Timestamp != threadTS {
+			messages = append(messages, copyMessage(m.message))
+		}
+	}
+	return messages, true
+}
+
+// storeMessage stores a message posted by `postedBy` and updates the thread it replies to.
+// It returns the stored message and the updated parent if the message is a reply
+func (sts *Server) storeMessage(m slack.Message, postedBy string) (slack.Message, slack.Message, bool) {
+	isReply := m.ThreadTimestamp != "" && m.ThreadTimestamp != m.Timestamp
+	if isReply {
+		if parent, ok := sts.messages.get(m.Channel, m.ThreadTimestamp); ok {
+			m.ParentUserId = parent.User
+		}
+	}
+	sts.messages.add(m, postedBy)
+	if !isReply {
+		return m, slack.Message{}, false
+	}
+	var parent slack.Message
+	found := sts.messages.update(m.Channel, m.ThreadTimestamp, func(sm *storedMessage) {
+		sm.message.ThreadTimestamp = sm.message.Timestamp
+		sm.message.ReplyCount++
+		sm.message.Replies = append(sm.message.Replies, slack.Reply{User: m.User, Timestamp: m.Timestamp})
+		parent = copyMessage(sm.message)
+	})
+	return m, parent, found
+}
+
+// recordMessage stores a message posted by `postedBy` and updates the thread it replies to.
+// It returns the stored message and, for a reply, the `message_replied` event to send after the reply itself
+func (sts *Server) recordMessage(m slack.Message, postedBy string) (slack.Message, *messageChangedEvent) {
+	m, parent, replied := sts.storeMessage(m, postedBy)
+	if !replied {
+		return m, nil
+	}
+	evt := messageChangedEvent{
+		SubMessage: &parent.Msg,
+	}
+	evt.Type = slack.TYPE_MESSAGE
+	evt.SubType = "message_replied"
+	evt.Hidden = true
+	evt.Channel = m.Channel
+	evt.Timestamp = newTimestamp()
+	evt.EventTimestamp = evt.Timestamp
+	return m, &evt
+}
+
+// queueReplied sends the `message_replied` event returned by recordMessage, if there is one.
+// `source` is recorded against the event
+func queueReplied(evt *messageChangedEvent, serverAddr, source string) {
+	if evt != nil {
+		queueEventForWebsocket(*evt, serverAddr, source)
+	}
+}
+
+// messageFromRTM converts a message sent by a websocket client into a slack.Message
+func messageFromRTM(data []byte, user string) (slack.Message, error) {
+	out := slack.OutgoingMessage{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return slack.Message{}, err
+	}
+	m := slack.Message{}
+	m.Type = slack.TYPE_MESSAGE
+	m.Channel = out.Channel
+	m.Text = out.Text
+	m.User = user
+	m.ThreadTimestamp = out.ThreadTimestamp
+	m.Timestamp = newTimestamp()
+	return m, nil
+}
+
+// SeedHistory stores `messages` in `channel` as if they had been sent before the test started and returns their timestamps.
+// Messages without a timestamp are given a new one. Nothing is sent to websocket clients
+func (sts *Server) SeedHistory(channel string, messages ...slack.Message) []string {
+	timestamps := make([]string, len(messages))
+	for i, m := range messages {
+		m.Channel = channel
+		if m.Type == "" {
+			m.Type = slack.TYPE_MESSAGE
+		}
+		if m.Timestamp == "" {
+			m.Timestamp = newTimestamp()
+		}
+		m, _, _ = sts.storeMessage(m, m.User)
+		timestamps[i] = m.Timestamp
+	}
+	return timestamps
+}
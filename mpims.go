@@ -0,0 +1,136 @@
+package slacktest
+
+import (
+	"strings"
+	"sync"
+
+	slack "github.com/nlopes/slack"
+)
+
+// minMPIMUsers and maxMPIMUsers bound how many users, including the caller, can share a multi-party direct message
+const minMPIMUsers = 3
+const maxMPIMUsers = 9
+
+type serverMPIMs struct {
+	sync.RWMutex
+	mpims []slack.Group
+}
+
+// sameMembers reports whether `a` and `b` contain the same users in any order
+func sameMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, m := range a {
+		if !hasMember(b, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// open adds `g` unless there's already a channel between the same members and returns the one in use.
+// It reports whether `g` was added
+func (sm *serverMPIMs) open(g slack.Group) (slack.Group, bool) {
+	sm.Lock()
+	defer sm.Unlock()
+	for _, existing := range sm.mpims {
+		if sameMembers(existing.Members, g.Members) {
+			return copyGroup(existing), false
+		}
+	}
+	sm.mpims = append(sm.mpims, copyGroup(g))
+	return copyGroup(g), true
+}
+
+// get returns the channel `id` if `user` is a member of it
+func (sm *serverMPIMs) get(user, id string) (slack.Group, bool) {
+	sm.RLock()
+	defer sm.RUnlock()
+	for _, g := range sm.mpims {
+		if g.ID == id && hasMember(g.Members, user) {
+			return copyGroup(g), true
+		}
+	}
+	return slack.Group{}, false
+}
+
+// forUser returns the channels `user` is a member of, oldest first
+func (sm *serverMPIMs) forUser(user string) []slack.Group {
+	sm.RLock()
+	defer sm.RUnlock()
+	groups := []slack.Group{}
+	for _, g := range sm.mpims {
+		if hasMember(g.Members, user) {
+			groups = append(groups, copyGroup(g))
+		}
+	}
+	return groups
+}
+
+// asMPIM returns `g` as slack sends multi-party direct messages
+func asMPIM(g slack.Group) mpimChannel {
+	return mpimChannel{Group: g, IsMpim: true}
+}
+
+// asMPIMs returns `groups` as slack sends multi-party direct messages
+func asMPIMs(groups []slack.Group) []mpimChannel {
+	mpims := make([]mpimChannel, len(groups))
+	for i, g := range groups {
+		mpims[i] = asMPIM(g)
+	}
+	return mpims
+}
+
+// openMPIM opens the multi-party direct message between `user` and `others`, creating it if needed,
+// and notifies connected clients when it's created. `source` is recorded against the resulting events
+func (sts *Server) openMPIM(user string, others []string, source string) (slack.Group, error) {
+	members := []string{user}
+	for _, o := range others {
+		if o != "" && !hasMember(members, o) {
+			members = append(members, o)
+		}
+	}
+	if len(members) < minMPIMUsers {
+		return slack.Group{}, ErrNotEnoughUsers
+	}
+	if len(members) > maxMPIMUsers {
+		return slack.Group{}, ErrTooManyUsers
+	}
+	users := sts.GetUsers()
+	names := make([]string, len(members))
+	for i, m := range members {
+		u, ok := findUser(users, m)
+		if !ok {
+			return slack.Group{}, ErrUserNotFound
+		}
+		names[i] = u.Name
+	}
+	g := slack.Group{}
+	g.ID = newID("G")
+	g.Name = "mpdm-" + strings.Join(names, "--") + "-1"
+	g.Created = nowAsJSONTime()
+	g.Creator = user
+	g.IsOpen = true
+	g.Members = members
+	g, created := sts.mpims.open(g)
+	if created {
+		queueEventForWebsocket(mpimJoinedEvent{
+			Type:    "mpim_joined",
+			Channel: asMPIM(g),
+		}, sts.ServerAddr, source)
+	}
+	return g, nil
+}
+
+// GetMPIMs returns the multi-party direct messages the bot is a member of
+func (sts *Server) GetMPIMs() []slack.Group {
+	return sts.mpims.forUser(sts.BotID)
+}
+
+// OpenMPIM opens a multi-party direct message between the bot and `users` and returns its id.
+// The same users always get the same channel
+func (sts *Server) OpenMPIM(users ...string) (string, error) {
+	g, err := sts.openMPIM(sts.BotID, users, SourceServer)
+	return g.ID, err
+}
@@ -0,0 +1,91 @@
+package slacktest
+
+import (
+	slack "github.com/nlopes/slack"
+)
+
+// ServerOption configures a Server created by NewTestServer
+type ServerOption func(*Server)
+
+// WithBotID sets the user id of the bot
+func WithBotID(id string) ServerOption {
+	return func(s *Server) {
+		s.BotID = id
+	}
+}
+
+// WithBotName sets the name of the bot
+func WithBotName(name string) ServerOption {
+	return func(s *Server) {
+		s.BotName = name
+	}
+}
+
+// WithTeamID sets the id of the team the bot belongs to
+func WithTeamID(id string) ServerOption {
+	return func(s *Server) {
+		s.TeamID = id
+	}
+}
+
+// WithTeamName sets the name of the team the bot belongs to
+func WithTeamName(name string) ServerOption {
+	return func(s *Server) {
+		s.TeamName = name
+	}
+}
+
+// WithTeamDomain sets the domain of the team the bot belongs to
+func WithTeamDomain(domain string) ServerOption {
+	return func(s *Server) {
+		s.TeamDomain = domain
+	}
+}
+
+// WithDefaultUser sets the human user that messages are sent as
+// when no other user is specified
+func WithDefaultUser(u slack.User) ServerOption {
+	return func(s *Server) {
+		s.defaultUser = u
+	}
+}
+
+// WithListenAddress sets the address the server listens on (i.e. `127.0.0.1:8080`).
+// NewTestServer panics if it can't listen there
+func WithListenAddress(addr string) ServerOption {
+	return func(s *Server) {
+		s.listenAddr = addr
+	}
+}
+
+// WithRateLimits limits every Web API method to Slack's published tier for it
+// and messages sent to a channel to about one per second
+func WithRateLimits() ServerOption {
+	return func(s *Server) {
+		s.rateLimits.enabled = true
+	}
+}
+
+// WithOutboundBuffer holds up to `n` events for websocket clients before new ones are refused
+// with ErrOutboundQueueFull. Zero or less means no limit
+func WithOutboundBuffer(n int) ServerOption {
+	return func(s *Server) {
+		s.outbound.capacity = n
+	}
+}
+
+// WithNoClientPolicy sets what happens to events sent while no websocket client is connected.
+// The default is HoldUntilConnected
+func WithNoClientPolicy(p NoClientPolicy) ServerOption {
+	return func(s *Server) {
+		s.outbound.policy = p
+	}
+}
+
+// WithTypingRelay sends a `user_typing` event to the other websocket clients
+// whenever a client sends a `typing` event
+func WithTypingRelay() ServerOption {
+	return func(s *Server) {
+		s.typing.relay = true
+	}
+}
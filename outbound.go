@@ -0,0 +1,179 @@
+package slacktest
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	websocket "github.com/gorilla/websocket"
+)
+
+// defaultOutboundBuffer is the number of events held for delivery before new ones are refused
+const defaultOutboundBuffer = 1000
+
+// flushInterval is how often Flush checks whether everything has been delivered
+const flushInterval = time.Millisecond
+
+// NoClientPolicy is what happens to events sent while no websocket client is connected
+type NoClientPolicy int
+
+const (
+	// HoldUntilConnected keeps events until a client connects. This is the default
+	HoldUntilConnected NoClientPolicy = iota
+	// DropWhenNoClients discards events nobody is connected to receive
+	DropWhenNoClients
+	// ErrorWhenNoClients discards events nobody is connected to receive and reports
+	// ErrNoClientsConnected from SendToWebsocket and Flush
+	ErrorWhenNoClients
+)
+
+// outboundQueue holds events for websocket clients in the order they were sent
+type outboundQueue struct {
+	sync.Mutex
+	pending  []RecordedEvent
+	capacity int
+	policy   NoClientPolicy
+	// clients returns the number of connected clients
+	clients func() int
+	// ready is signalled when an event is queued
+	ready chan struct{}
+	// delivering is set while an event taken from the queue is handed to clients
+	delivering bool
+	// err is the first error since the last Flush
+	err error
+}
+
+func newOutboundQueue() *outboundQueue {
+	return &outboundQueue{
+		capacity: defaultOutboundBuffer,
+		clients:  func() int { return 0 },
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// enqueue records `e` in `seen` and queues it for delivery.
+// Both happen under the queue's lock so events are recorded in the order they are delivered
+func (q *outboundQueue) enqueue(e RecordedEvent, seen *messageCollection) error {
+	q.Lock()
+	defer q.Unlock()
+	seen.add(e)
+	if q.clients() == 0 {
+		switch q.policy {
+		case DropWhenNoClients:
+			return nil
+		case ErrorWhenNoClients:
+			return q.fail(ErrNoClientsConnected)
+		}
+	}
+	if q.capacity > 0 && len(q.pending) >= q.capacity {
+		return q.fail(ErrOutboundQueueFull)
+	}
+	q.pending = append(q.pending, e)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// fail remembers `err` for Flush if it's the first since the last Flush and returns it
+func (q *outboundQueue) fail(err error) error {
+	if q.err == nil {
+		q.err = err
+	}
+	return err
+}
+
+// pop takes the oldest event from the queue
+func (q *outboundQueue) pop() (RecordedEvent, bool) {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.pending) == 0 {
+		return RecordedEvent{}, false
+	}
+	e := q.pending[0]
+	q.pending = q.pending[1:]
+	q.delivering = true
+	return e, true
+}
+
+// delivered marks the event taken by pop as handed to every client
+func (q *outboundQueue) delivered() {
+	q.Lock()
+	q.delivering = false
+	q.Unlock()
+}
+
+// idle reports whether nothing is waiting in the queue
+func (q *outboundQueue) idle() bool {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.pending) == 0 && !q.delivering
+}
+
+// takeErr returns and forgets the first error since the last call
+func (q *outboundQueue) takeErr() error {
+	q.Lock()
+	defer q.Unlock()
+	err := q.err
+	q.err = nil
+	return err
+}
+
+// dispatchOutbound fans out queued events to every connected client until `quit` is closed.
+// Events wait in the queue while no client is connected
+func (sts *Server) dispatchOutbound(q *outboundQueue, quit chan struct{}) {
+	for {
+		sts.connections.RLock()
+		changed := sts.connections.changed
+		connected := len(sts.connections.conns) > 0
+		sts.connections.RUnlock()
+		if connected {
+			if e, ok := q.pop(); ok {
+				for _, rc := range sts.connections.deliver(e) {
+					// closing a client waits on its blocked writer so it happens in the background
+					log.Printf("closing websocket client %s: stopped reading", rc.id)
+					go sts.disconnect(rc, websocket.ClosePolicyViolation, "stopped reading")
+				}
+				q.delivered()
+				continue
+			}
+		}
+		select {
+		case <-q.ready:
+		case <-changed:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Flush blocks until every event sent so far has been written to the connected clients or `ctx` is done.
+// It returns the first error from sending events since the last Flush
+func (sts *Server) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for !sts.flushed() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return sts.outbound.takeErr()
+}
+
+// flushed reports whether nothing is waiting to be written to any client
+func (sts *Server) flushed() bool {
+	if !sts.outbound.idle() {
+		return false
+	}
+	for _, rc := range sts.connections.all() {
+		if !rc.closed() && atomic.LoadInt64(&rc.pending) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package slacktest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboundIsOrdered(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	var expected []string
+	for i := 0; i < 50; i++ {
+		text := fmt.Sprintf("message %d", i)
+		expected = append(expected, text)
+		s.SendMessageToChannel("C024BE91L", text)
+	}
+	c := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = c.Close() }()
+	assert.Equal(t, expected, readTexts(t, c, len(expected)), "held messages should arrive in the order they were sent")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Flush(ctx))
+	s.Stop()
+}
+
+func TestFlushWaitsForClients(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"held"}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.EqualError(t, s.Flush(ctx), context.DeadlineExceeded.Error(), "held events aren't delivered until a client connects")
+	c := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = c.Close() }()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Flush(ctx))
+	assert.Equal(t, []string{"held"}, readTexts(t, c, 1))
+	s.Stop()
+}
+
+func TestNoClientPolicies(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := NewTestServer(WithNoClientPolicy(DropWhenNoClients))
+	go s.Start()
+	assert.NoError(t, s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"dropped"}`))
+	assert.NoError(t, s.Flush(ctx), "dropped events shouldn't be waited for")
+	assert.True(t, s.SawOutgoingMessage("dropped"), "dropped events should still be recorded")
+	c := dialAs(t, s, "xoxb-bot")
+	waitForClients(s, 1)
+	s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"delivered"}`)
+	assert.Equal(t, []string{"delivered"}, readTexts(t, c, 1))
+	_ = c.Close()
+	s.Stop()
+
+	s = NewTestServer(WithNoClientPolicy(ErrorWhenNoClients))
+	// nothing connects before Stop so start synchronously
+	s.Start()
+	assert.EqualError(t, s.SendToWebsocket(`{"type":"goodbye"}`), ErrNoClientsConnected.Error())
+	s.SendMessageToChannel("C024BE91L", "lost")
+	assert.EqualError(t, s.Flush(ctx), ErrNoClientsConnected.Error())
+	assert.NoError(t, s.Flush(ctx), "errors should be reported once")
+	s.Stop()
+}
+
+func TestOutboundBufferFull(t *testing.T) {
+	s := NewTestServer(WithOutboundBuffer(2))
+	go s.Start()
+	assert.NoError(t, s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"one"}`))
+	assert.NoError(t, s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"two"}`))
+	assert.EqualError(t, s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"three"}`), ErrOutboundQueueFull.Error())
+	c := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = c.Close() }()
+	assert.Equal(t, []string{"one", "two"}, readTexts(t, c, 2))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.EqualError(t, s.Flush(ctx), ErrOutboundQueueFull.Error())
+	s.Stop()
+}
+
+func TestSlowClientIsWaitedFor(t *testing.T) {
+	s := NewTestServer(WithOutboundBuffer(0))
+	s.connections.stuckAfter = 50 * time.Millisecond
+	go s.Start()
+	c := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = c.Close() }()
+	waitForClients(s, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the client is slower than the queue for the connection but keeps reading
+	s.SetWebsocketLatency(DirectionOutbound, FixedLatency(2*time.Millisecond))
+	sendTexts := func(prefix string, n int) {
+		for i := 0; i < n; i++ {
+			assert.NoError(t, s.SendToWebsocket(fmt.Sprintf(`{"type":"message","channel":"C024BE91L","text":"%s %d"}`, prefix, i)))
+		}
+	}
+	slow := connectionBuffer + connectionBuffer/4
+	sendTexts("slow", slow)
+	texts := readTexts(t, c, slow)
+	assert.Len(t, texts, slow)
+	assert.NoError(t, s.Flush(ctx))
+	s.SetWebsocketLatency(DirectionOutbound, nil)
+
+	// a burst bigger than the queue for the connection
+	fast := 2000
+	sendTexts("fast", fast)
+	texts = readTexts(t, c, fast)
+	if assert.Len(t, texts, fast) {
+		assert.Equal(t, fmt.Sprintf("fast %d", fast-1), texts[fast-1])
+	}
+	assert.NoError(t, s.Flush(ctx))
+	assert.Len(t, s.ConnectedClients(), 1, "a client that keeps reading shouldn't be closed")
+	s.Stop()
+}
+
+func TestStuckClientIsClosed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fills the socket buffers of a client that never reads")
+	}
+	s := NewTestServer()
+	s.connections.stuckAfter = 100 * time.Millisecond
+	go s.Start()
+	disconnects := make(chan string, 2)
+	s.OnDisconnect(func(id string) { disconnects <- id })
+	stuck := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = stuck.Close() }()
+	reader := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = reader.Close() }()
+	clients := waitForClients(s, 2)
+	if !assert.Len(t, clients, 2) {
+		t.FailNow()
+	}
+	got := make(chan string, connectionBuffer)
+	go func() {
+		defer close(got)
+		for {
+			m := slack.Message{}
+			if err := reader.ReadJSON(&m); err != nil {
+				return
+			}
+			if m.Type == slack.TYPE_MESSAGE {
+				got <- m.Text
+			}
+		}
+	}()
+
+	// the stuck client never reads so its socket fills up and writing to it blocks
+	text := strings.Repeat("x", 64*1024)
+	var closed string
+	for i := 0; closed == "" && i < 2000; i++ {
+		assert.NoError(t, s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"`+text+`"}`))
+		select {
+		case m := <-got:
+			if !assert.Equal(t, text, m, "the other client should get every event") {
+				t.FailNow()
+			}
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "the other client was held up")
+		}
+		select {
+		case closed = <-disconnects:
+		default:
+		}
+	}
+	if closed == "" {
+		select {
+		case closed = <-disconnects:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	assert.Equal(t, clients[0], closed, "the client that stopped reading should be closed")
+	assert.NoError(t, s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"last"}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Flush(ctx), "a stuck client shouldn't hold up Flush")
+	assert.Equal(t, "last", <-got)
+	assert.Equal(t, []string{clients[1]}, s.ConnectedClients())
+	s.Stop()
+}
@@ -0,0 +1,233 @@
+package slacktest
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is the number of calls allowed in a period.
+// Calls may burst up to Requests at once and are then refilled evenly over Per
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Slack's published Web API rate limit tiers
+var (
+	RateLimitTier1 = RateLimit{Requests: 1, Per: time.Minute}
+	RateLimitTier2 = RateLimit{Requests: 20, Per: time.Minute}
+	RateLimitTier3 = RateLimit{Requests: 50, Per: time.Minute}
+	RateLimitTier4 = RateLimit{Requests: 100, Per: time.Minute}
+	// RateLimitPerChannel is the limit for posting messages to a single channel
+	// via chat.postMessage or the RTM api
+	RateLimitPerChannel = RateLimit{Requests: 1, Per: time.Second}
+)
+
+// defaultRateLimits are the tiers Slack publishes for the methods we implement.
+// chat.postMessage is limited per channel instead
+var defaultRateLimits = map[string]RateLimit{
+	"rtm.start":             RateLimitTier1,
+	"channels.list":         RateLimitTier2,
+	"groups.list":           RateLimitTier2,
+	"users.list":            RateLimitTier2,
+	"channels.create":       RateLimitTier2,
+	"channels.invite":       RateLimitTier2,
+	"reactions.list":        RateLimitTier2,
+	"reactions.remove":      RateLimitTier2,
+	"chat.update":           RateLimitTier3,
+	"chat.delete":           RateLimitTier3,
+	"channels.info":         RateLimitTier3,
+	"groups.info":           RateLimitTier3,
+	"channels.archive":      RateLimitTier2,
+	"channels.unarchive":    RateLimitTier2,
+	"channels.rename":       RateLimitTier2,
+	"channels.kick":         RateLimitTier3,
+	"channels.join":         RateLimitTier3,
+	"channels.leave":        RateLimitTier3,
+	"channels.setTopic":     RateLimitTier2,
+	"channels.setPurpose":   RateLimitTier2,
+	"channels.replies":      RateLimitTier3,
+	"conversations.replies": RateLimitTier3,
+	"reactions.add":         RateLimitTier3,
+	"reactions.get":         RateLimitTier3,
+	"users.getPresence":     RateLimitTier3,
+	"users.info":            RateLimitTier4,
+	"users.profile.get":     RateLimitTier4,
+	"bots.info":             RateLimitTier4,
+}
+
+// defaultRateLimit applies to methods without a published tier
+var defaultRateLimit = RateLimitTier3
+
+// perChannelRateLimitMethod is limited per channel rather than per method
+const perChannelRateLimitMethod = "chat.postMessage"
+
+// rtmRateLimitKey prefixes the buckets of channels messaged over the RTM api
+const rtmRateLimitKey = "rtm:"
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type serverRateLimits struct {
+	sync.Mutex
+	// enabled applies the default tiers to every method
+	enabled   bool
+	overrides map[string]RateLimit
+	buckets   map[string]*rateBucket
+}
+
+func newServerRateLimits() *serverRateLimits {
+	return &serverRateLimits{
+		overrides: make(map[string]RateLimit),
+		buckets:   make(map[string]*rateBucket),
+	}
+}
+
+// limitFor returns the limit for `method` if it's limited
+func (rl *serverRateLimits) limitFor(method string) (RateLimit, bool) {
+	if l, ok := rl.overrides[method]; ok {
+		return l, true
+	}
+	if !rl.enabled {
+		return RateLimit{}, false
+	}
+	if method == perChannelRateLimitMethod {
+		return RateLimitPerChannel, true
+	}
+	if l, ok := defaultRateLimits[method]; ok {
+		return l, true
+	}
+	return defaultRateLimit, true
+}
+
+// take uses up a call from the bucket `key` limited by `limit`.
+// When the bucket is empty it returns how long until a call is allowed
+func (rl *serverRateLimits) take(key string, limit RateLimit) (time.Duration, bool) {
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return limit.Per, false
+	}
+	now := time.Now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: float64(limit.Requests), last: now}
+		rl.buckets[key] = b
+	}
+	rate := float64(limit.Requests) / float64(limit.Per)
+	b.tokens = math.Min(float64(limit.Requests), b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / rate), false
+}
+
+// allow reports whether a call to `method` in `channel` is allowed
+func (rl *serverRateLimits) allow(method, channel string) (time.Duration, bool) {
+	rl.Lock()
+	defer rl.Unlock()
+	limit, ok := rl.limitFor(method)
+	if !ok {
+		return 0, true
+	}
+	key := method
+	if method == perChannelRateLimitMethod {
+		key = method + ":" + channel
+	}
+	return rl.take(key, limit)
+}
+
+// allowRTM reports whether a message over the RTM api to `channel` is allowed.
+// It's limited like chat.postMessage but counted separately
+func (rl *serverRateLimits) allowRTM(channel string) bool {
+	rl.Lock()
+	defer rl.Unlock()
+	limit, ok := rl.limitFor(perChannelRateLimitMethod)
+	if !ok {
+		return true
+	}
+	_, ok = rl.take(rtmRateLimitKey+channel, limit)
+	return ok
+}
+
+// set overrides the limit for `method` and forgets the calls already made to it
+func (rl *serverRateLimits) set(method string, limit RateLimit) {
+	rl.Lock()
+	defer rl.Unlock()
+	rl.overrides[method] = limit
+	for key := range rl.buckets {
+		if key == method || strings.HasPrefix(key, method+":") {
+			delete(rl.buckets, key)
+		}
+		if method == perChannelRateLimitMethod && strings.HasPrefix(key, rtmRateLimitKey) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func (rl *serverRateLimits) reset() {
+	rl.Lock()
+	rl.buckets = make(map[string]*rateBucket)
+	rl.Unlock()
+}
+
+// retryAfterSeconds rounds `d` up to whole seconds for the Retry-After header
+func retryAfterSeconds(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 1 {
+		return 1
+	}
+	return s
+}
+
+// rateLimitHandler returns `429 Too Many Requests` instead of calling `next` once a method is over its limit.
+// The websocket endpoint and file downloads are not Web API methods and are never limited
+func rateLimitHandler(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		method := apiMethod(r)
+		channel := ""
+		if method == perChannelRateLimitMethod {
+			params, err := journalParams(r)
+			if err != nil {
+				log.Printf("Unable to parse params for rate limits: %s", err.Error())
+			}
+			channel = params.Get("channel")
+		}
+		wait, ok := s.rateLimits.allow(method, channel)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		writeSlackError(w, "ratelimited")
+	})
+}
+
+// rtmRateLimitedReply is sent to websocket clients that message a channel too quickly
+func rtmRateLimitedReply(replyTo int) []byte {
+	return rtmErrorAck(replyTo, rtmErrRateLimited, "rate limit exceeded")
+}
+
+// SetRateLimit limits calls to `method` to `limit`.
+// Limits set this way apply even if the server wasn't created with WithRateLimits
+func (sts *Server) SetRateLimit(method string, limit RateLimit) {
+	sts.rateLimits.set(method, limit)
+}
+
+// ResetRateLimits allows every method to be called again as if no calls had been made
+func (sts *Server) ResetRateLimits() {
+	sts.rateLimits.reset()
+}
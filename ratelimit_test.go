@@ -0,0 +1,124 @@
+package slacktest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func postStatus(t *testing.T, s *Server, method string, values url.Values) *http.Response {
+	resp, err := http.PostForm(s.GetAPIURL()+method, values)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return resp
+}
+
+func TestSetRateLimit(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.SetRateLimit("users.info", RateLimit{Requests: 2, Per: time.Minute})
+	values := url.Values{"user": {"W012A3CDE"}}
+	for i := 0; i < 2; i++ {
+		resp := postStatus(t, s, "users.info", values)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+	resp := postStatus(t, s, "users.info", values)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.JSONEq(t, `{"ok":false,"error":"ratelimited"}`, string(body))
+
+	resp = postStatus(t, s, "users.list", url.Values{})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "other methods should not be limited by default")
+	_ = resp.Body.Close()
+
+	s.ResetRateLimits()
+	resp = postStatus(t, s, "users.info", values)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+	s.Stop()
+}
+
+func TestWithRateLimits(t *testing.T) {
+	s := NewTestServer(WithRateLimits())
+	go s.Start()
+	resp := postStatus(t, s, "chat.postMessage", url.Values{"channel": {"C024BE91L"}, "text": {"first"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+	resp = postStatus(t, s, "chat.postMessage", url.Values{"channel": {"C024BE91L"}, "text": {"second"}})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	_ = resp.Body.Close()
+	resp = postStatus(t, s, "chat.postMessage", url.Values{"channel": {"C024BE92L"}, "text": {"other channel"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "channels should be limited separately")
+	_ = resp.Body.Close()
+
+	resp = postStatus(t, s, "rtm.start", url.Values{})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+	resp = postStatus(t, s, "rtm.start", url.Values{})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "rtm.start should be tier 1")
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+	_ = resp.Body.Close()
+	s.Stop()
+}
+
+func TestRTMRateLimitedReply(t *testing.T) {
+	reply := slack.AckMessage{}
+	assert.NoError(t, json.Unmarshal(rtmRateLimitedReply(3), &reply))
+	assert.Equal(t, 3, reply.ReplyTo)
+	assert.False(t, reply.Ok)
+	if assert.NotNil(t, reply.Error) {
+		assert.Equal(t, "rate limit exceeded", reply.Error.Msg)
+	}
+}
+
+func TestRateLimitBucketRefills(t *testing.T) {
+	rl := newServerRateLimits()
+	limit := RateLimit{Requests: 1, Per: 20 * time.Millisecond}
+	_, ok := rl.take("foo", limit)
+	assert.True(t, ok)
+	wait, ok := rl.take("foo", limit)
+	assert.False(t, ok)
+	assert.True(t, wait > 0 && wait <= 20*time.Millisecond)
+	time.Sleep(wait + 5*time.Millisecond)
+	_, ok = rl.take("foo", limit)
+	assert.True(t, ok, "bucket should have refilled")
+	assert.True(t, rl.allowRTM("C024BE91L"), "rtm should not be limited unless enabled")
+}
+
+func TestSetRateLimitOverridesChannelBuckets(t *testing.T) {
+	rl := newServerRateLimits()
+	rl.enabled = true
+	_, ok := rl.allow("chat.postMessage", "C024BE91L")
+	assert.True(t, ok)
+	_, ok = rl.allow("chat.postMessage", "C024BE91L")
+	assert.False(t, ok)
+	assert.True(t, rl.allowRTM("C024BE91L"))
+	assert.False(t, rl.allowRTM("C024BE91L"))
+
+	// overriding the limit forgets the calls made to every channel
+	rl.set("chat.postMessage", RateLimit{Requests: 3, Per: time.Minute})
+	for i := 0; i < 3; i++ {
+		_, ok = rl.allow("chat.postMessage", "C024BE91L")
+		assert.True(t, ok, "call %d should be allowed by the new limit", i)
+		assert.True(t, rl.allowRTM("C024BE91L"), "rtm message %d should be allowed by the new limit", i)
+	}
+	_, ok = rl.allow("chat.postMessage", "C024BE91L")
+	assert.False(t, ok)
+	assert.False(t, rl.allowRTM("C024BE91L"))
+
+	rl = newServerRateLimits()
+	rl.set("chat.postMessage", RateLimit{Requests: 1, Per: time.Minute})
+	assert.True(t, rl.allowRTM("C024BE91L"))
+	assert.False(t, rl.allowRTM("C024BE91L"), "an override should limit rtm without WithRateLimits")
+}
@@ -0,0 +1,154 @@
+package slacktest
+
+import (
+	"strings"
+
+	slack "github.com/nlopes/slack"
+)
+
+// normalizeReaction strips the surrounding colons from an emoji name such as `:thumbsup:`
+func normalizeReaction(name string) string {
+	return strings.Trim(name, ":")
+}
+
+// addReaction adds the reaction `name` from `user` to a message and notifies connected clients
+func (sts *Server) addReaction(user, channel, ts, name, source string) error {
+	name = normalizeReaction(name)
+	if name == "" {
+		return ErrInvalidReaction
+	}
+	var rErr error
+	itemUser := ""
+	found := sts.messages.update(channel, ts, func(sm *storedMessage) {
+		itemUser = sm.message.User
+		for i, r := range sm.message.Reactions {
+			if r.Name != name {
+				continue
+			}
+			if hasMember(r.Users, user) {
+				rErr = ErrAlreadyReacted
+				return
+			}
+			sm.message.Reactions[i].Users = append(r.Users, user)
+			sm.message.Reactions[i].Count++
+			return
+		}
+		sm.message.Reactions = append(sm.message.Reactions, slack.ItemReaction{
+			Name:  name,
+			Count: 1,
+			Users: []string{user},
+		})
+	})
+	if !found {
+		return ErrMessageNotFound
+	}
+	if rErr != nil {
+		return rErr
+	}
+	evt := slack.ReactionAddedEvent{
+		Type:           "reaction_added",
+		User:           user,
+		ItemUser:       itemUser,
+		Reaction:       name,
+		EventTimestamp: newTimestamp(),
+	}
+	evt.Item.Type = slack.TYPE_MESSAGE
+	evt.Item.Channel = channel
+	evt.Item.Timestamp = ts
+	queueEventForWebsocket(evt, sts.ServerAddr, source)
+	return nil
+}
+
+// removeReaction removes the reaction `name` from `user` on a message and notifies connected clients
+func (sts *Server) removeReaction(user, channel, ts, name, source string) error {
+	name = normalizeReaction(name)
+	if name == "" {
+		return ErrInvalidReaction
+	}
+	rErr := ErrNoReaction
+	itemUser := ""
+	found := sts.messages.update(channel, ts, func(sm *storedMessage) {
+		itemUser = sm.message.User
+		for i, r := range sm.message.Reactions {
+			if r.Name != name || !hasMember(r.Users, user) {
+				continue
+			}
+			rErr = nil
+			if r.Count <= 1 {
+				sm.message.Reactions = append(sm.message.Reactions[:i], sm.message.Reactions[i+1:]...)
+				return
+			}
+			sm.message.Reactions[i].Users = removeMember(r.Users, user)
+			sm.message.Reactions[i].Count--
+			return
+		}
+	})
+	if !found {
+		return ErrMessageNotFound
+	}
+	if rErr != nil {
+		return rErr
+	}
+	evt := slack.ReactionRemovedEvent{
+		Type:           "reaction_removed",
+		User:           user,
+		ItemUser:       itemUser,
+		Reaction:       name,
+		EventTimestamp: newTimestamp(),
+	}
+	evt.Item.Type = slack.TYPE_MESSAGE
+	evt.Item.Channel = channel
+	evt.Item.Timestamp = ts
+	queueEventForWebsocket(evt, sts.ServerAddr, source)
+	return nil
+}
+
+// reactedBy returns the messages `user` has reacted to, oldest first
+func (sm *serverMessages) reactedBy(user string) []slack.Message {
+	sm.RLock()
+	defer sm.RUnlock()
+	var messages []slack.Message
+	for _, m := range sm.messages {
+		for _, r := range m.message.Reactions {
+			if hasMember(r.Users, user) {
+				messages = append(messages, copyMessage(m.message))
+				break
+			}
+		}
+	}
+	return messages
+}
+
+// AddReactionAsUser adds the emoji reaction `name` from `user` to a message
+func (sts *Server) AddReactionAsUser(user, channel, ts, name string) error {
+	return sts.addReaction(user, channel, ts, name, SourceServer)
+}
+
+// RemoveReactionAsUser removes the emoji reaction `name` from `user` on a message
+func (sts *Server) RemoveReactionAsUser(user, channel, ts, name string) error {
+	return sts.removeReaction(user, channel, ts, name, SourceServer)
+}
+
+// GetReactions returns the reactions on a message
+func (sts *Server) GetReactions(channel, ts string) ([]slack.ItemReaction, error) {
+	m, err := sts.GetMessage(channel, ts)
+	if err != nil {
+		return nil, err
+	}
+	return m.Reactions, nil
+}
+
+// BotReacted checks if the bot reacted to a message with the emoji `name`
+func (sts *Server) BotReacted(channel, ts, name string) bool {
+	reactions, err := sts.GetReactions(channel, ts)
+	if err != nil {
+		return false
+	}
+	name = normalizeReaction(name)
+	for _, r := range reactions {
+		if r.Name == name && hasMember(r.Users, sts.BotID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package slacktest
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Direction is the direction an event travelled over the websocket
+type Direction string
+
+const (
+	// DirectionInbound is an event sent by a websocket client to the server
+	DirectionInbound Direction = "inbound"
+	// DirectionOutbound is an event sent by the server to websocket clients
+	DirectionOutbound Direction = "outbound"
+)
+
+const (
+	// SourceRTM is the source of events sent by websocket clients
+	SourceRTM = "rtm"
+	// SourceServer is the source of events pushed by the test server itself
+	// (e.g. SendMessageToChannel or SendToWebsocket)
+	SourceServer = "server"
+)
+
+// RecordedEvent is an event seen on the websocket along with where it came from
+type RecordedEvent struct {
+	Direction Direction
+	// Source is SourceRTM, SourceServer or the Web API method that caused the event
+	// such as `chat.postMessage`
+	Source          string
+	Type            string
+	SubType         string
+	Channel         string
+	User            string
+	Text            string
+	Timestamp       string
+	ThreadTimestamp string
+	// Raw is the json exactly as it was sent
+	Raw        string
+	ReceivedAt time.Time
+}
+
+// EventFilter reports whether a recorded event should be returned by a query
+type EventFilter func(RecordedEvent) bool
+
+// EventInChannel matches events for the channel `channel`
+func EventInChannel(channel string) EventFilter {
+	return func(e RecordedEvent) bool {
+		return e.Channel == channel
+	}
+}
+
+// EventFromUser matches events sent by or about the user `user`
+func EventFromUser(user string) EventFilter {
+	return func(e RecordedEvent) bool {
+		return e.User == user
+	}
+}
+
+// EventOfType matches events of type `t`
+func EventOfType(t string) EventFilter {
+	return func(e RecordedEvent) bool {
+		return e.Type == t
+	}
+}
+
+// EventWithSubType matches events with the subtype `subtype`
+func EventWithSubType(subtype string) EventFilter {
+	return func(e RecordedEvent) bool {
+		return e.SubType == subtype
+	}
+}
+
+// EventFromSource matches events from `source`, either SourceRTM, SourceServer or a Web API method
+func EventFromSource(source string) EventFilter {
+	return func(e RecordedEvent) bool {
+		return e.Source == source
+	}
+}
+
+// EventInThread matches events in the thread started by the message `threadTS`
+func EventInThread(threadTS string) EventFilter {
+	return func(e RecordedEvent) bool {
+		return e.ThreadTimestamp == threadTS
+	}
+}
+
+// EventWithText matches events with exactly the text `text`
+func EventWithText(text string) EventFilter {
+	return func(e RecordedEvent) bool {
+		return e.Text == text
+	}
+}
+
+// matches reports whether `e` is matched by every one of `filters`
+func (e RecordedEvent) matches(filters []EventFilter) bool {
+	for _, f := range filters {
+		if !f(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordedEventFields are the fields of an event we index on.
+// channel and user are objects in some events and ids in others
+type recordedEventFields struct {
+	Type            string          `json:"type"`
+	SubType         string          `json:"subtype"`
+	Channel         json.RawMessage `json:"channel"`
+	User            json.RawMessage `json:"user"`
+	Text            string          `json:"text"`
+	Timestamp       string          `json:"ts"`
+	ThreadTimestamp string          `json:"thread_ts"`
+	EventTimestamp  string          `json:"event_ts"`
+	ChannelID       string          `json:"channel_id"`
+	Item            struct {
+		Channel string `json:"channel"`
+	} `json:"item"`
+	Message *struct {
+		User            string `json:"user"`
+		ThreadTimestamp string `json:"thread_ts"`
+	} `json:"message"`
+}
+
+// rawID returns the id in `raw` which is either a plain string or an object with an id
+func rawID(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	obj := struct {
+		ID string `json:"id"`
+	}{}
+	if err := json.Unmarshal(raw, &obj); err == nil {
+		return obj.ID
+	}
+	return ""
+}
+
+// newRecordedEvent indexes the json event `raw`.
+// Events that can't be decoded are still recorded with only their raw json
+func newRecordedEvent(direction Direction, source, raw string) RecordedEvent {
+	e := RecordedEvent{
+		Direction:  direction,
+		Source:     source,
+		Raw:        raw,
+		ReceivedAt: time.Now(),
+	}
+	f := recordedEventFields{}
+	if err := json.Unmarshal([]byte(raw), &f); err != nil {
+		return e
+	}
+	e.Type = f.Type
+	e.SubType = f.SubType
+	e.Channel = rawID(f.Channel)
+	if e.Channel == "" {
+		e.Channel = f.Item.Channel
+	}
+	if e.Channel == "" {
+		e.Channel = f.ChannelID
+	}
+	e.User = rawID(f.User)
+	e.Text = f.Text
+	e.Timestamp = f.Timestamp
+	if e.Timestamp == "" {
+		e.Timestamp = f.EventTimestamp
+	}
+	e.ThreadTimestamp = f.ThreadTimestamp
+	if f.Message != nil {
+		if e.User == "" {
+			e.User = f.Message.User
+		}
+		if e.ThreadTimestamp == "" {
+			e.ThreadTimestamp = f.Message.ThreadTimestamp
+		}
+	}
+	return e
+}
+
+// events returns the collected events matched by `filters`
+func (mc *messageCollection) events(filters []EventFilter) []RecordedEvent {
+	mc.RLock()
+	defer mc.RUnlock()
+	var events []RecordedEvent
+	for _, e := range mc.messages {
+		if e.matches(filters) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// GetInboundEvents returns the events sent by websocket clients matched by every one of `filters`
+func (sts *Server) GetInboundEvents(filters ...EventFilter) []RecordedEvent {
+	return sts.seenInboundMessages.events(filters)
+}
+
+// GetOutboundEvents returns the events sent to websocket clients matched by every one of `filters`
+func (sts *Server) GetOutboundEvents(filters ...EventFilter) []RecordedEvent {
+	return sts.seenOutboundMessages.events(filters)
+}
+
+// GetRecordedEvents returns the events seen in either direction matched by every one of `filters`,
+// ordered by the time they were received
+func (sts *Server) GetRecordedEvents(filters ...EventFilter) []RecordedEvent {
+	events := append(sts.GetInboundEvents(filters...), sts.GetOutboundEvents(filters...)...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ReceivedAt.Before(events[j].ReceivedAt)
+	})
+	return events
+}
@@ -0,0 +1,88 @@
+package slacktest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRecordedEvent(t *testing.T) {
+	e := newRecordedEvent(DirectionOutbound, "channels.create", `{"type":"channel_created","channel":{"id":"C123","name":"foo","creator":"W123"}}`)
+	assert.Equal(t, DirectionOutbound, e.Direction)
+	assert.Equal(t, "channels.create", e.Source)
+	assert.Equal(t, "channel_created", e.Type)
+	assert.Equal(t, "C123", e.Channel)
+	assert.False(t, e.ReceivedAt.IsZero())
+
+	e = newRecordedEvent(DirectionOutbound, SourceServer, `{"type":"reaction_added","user":"W123","item":{"type":"message","channel":"C123","ts":"1.1"},"event_ts":"2.2"}`)
+	assert.Equal(t, "C123", e.Channel)
+	assert.Equal(t, "W123", e.User)
+	assert.Equal(t, "2.2", e.Timestamp)
+
+	e = newRecordedEvent(DirectionInbound, SourceRTM, "not json")
+	assert.Equal(t, "not json", e.Raw)
+	assert.Empty(t, e.Type)
+}
+
+func TestRecordedEventsFilters(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	ts := s.SendMessageToChannel("C024BE91L", "parent")
+	s.SendThreadReplyToChannel("C024BE91L", ts, "reply")
+	s.SendMessageToChannel("C024BE92L", "elsewhere")
+	_, err := http.PostForm(s.GetAPIURL()+"chat.postMessage", url.Values{
+		"channel": {"C024BE92L"},
+		"text":    {"from the api"},
+		"as_user": {"true"},
+	})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = s.WaitForOutbound(ctx, MessageWithText("from the api"))
+	assert.NoError(t, err)
+	_, err = s.WaitForOutbound(ctx, MessageWithText("elsewhere"))
+	assert.NoError(t, err)
+
+	inChannel := s.GetOutboundEvents(EventInChannel("C024BE92L"), EventOfType(slack.TYPE_MESSAGE))
+	assert.Len(t, inChannel, 2)
+	fromBot := s.GetOutboundEvents(EventFromUser(s.BotID))
+	if assert.Len(t, fromBot, 1) {
+		assert.Equal(t, "from the api", fromBot[0].Text)
+		assert.Equal(t, "chat.postMessage", fromBot[0].Source)
+		assert.Equal(t, DirectionOutbound, fromBot[0].Direction)
+	}
+	thread := s.GetOutboundEvents(EventInThread(ts), EventWithText("reply"))
+	if assert.Len(t, thread, 1) {
+		assert.Equal(t, SourceServer, thread[0].Source)
+		assert.Equal(t, s.defaultUser.ID, thread[0].User)
+	}
+	assert.Len(t, s.GetInboundEvents(), 0)
+	assert.Len(t, s.GetRecordedEvents(EventFromSource("chat.postMessage")), 1)
+	assert.Len(t, s.GetSeenOutboundMessages(), len(s.GetOutboundEvents()), "raw messages should still be available")
+	s.Stop()
+}
+
+func TestInboundEventsFromUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddToken("xoxp-observer", s.defaultUser.ID)
+	c := dialAs(t, s, "xoxp-observer")
+	defer func() { _ = c.Close() }()
+	assert.NoError(t, c.WriteJSON(slack.OutgoingMessage{ID: 1, Type: "message", Channel: "C024BE91L", Text: "inbound"}))
+	ack := slack.AckMessage{}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, c.ReadJSON(&ack))
+	// the event is recorded by the time the client is acknowledged
+	inbound := s.GetInboundEvents(EventFromUser(s.defaultUser.ID))
+	if assert.Len(t, inbound, 1) {
+		assert.Equal(t, "inbound", inbound[0].Text)
+		assert.Equal(t, SourceRTM, inbound[0].Source)
+	}
+	assert.Len(t, s.GetInboundEvents(EventFromUser(s.BotID)), 0)
+	s.Stop()
+}
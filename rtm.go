@@ -0,0 +1,90 @@
+package slacktest
+
+import (
+	"encoding/json"
+	"net/url"
+	"unicode/utf8"
+
+	slack "github.com/nlopes/slack"
+)
+
+// maxRTMMessageSize is the largest message Slack accepts over the websocket
+const maxRTMMessageSize = 16 * 1024
+
+// maxPostMessageLength is the most characters Slack accepts in the text of chat.postMessage
+const maxPostMessageLength = 40000
+
+// Error codes sent in RTM error acks
+const (
+	rtmErrRateLimited    = 1
+	rtmErrInvalidChannel = 2
+	rtmErrMessageTooLong = 3
+	rtmErrArchived       = 4
+)
+
+// rtmAck is sent to websocket clients once a message they sent has been posted
+func rtmAck(replyTo int, m slack.Message) []byte {
+	ack := map[string]interface{}{
+		"ok":       true,
+		"reply_to": replyTo,
+		"ts":       m.Timestamp,
+		"text":     m.Text,
+	}
+	j, _ := json.Marshal(ack)
+	return j
+}
+
+// rtmErrorAck is sent to websocket clients when a message they sent is rejected
+func rtmErrorAck(replyTo int, code int, msg string) []byte {
+	reply := map[string]interface{}{
+		"ok":       false,
+		"reply_to": replyTo,
+		"error": map[string]interface{}{
+			"code": code,
+			"msg":  msg,
+		},
+	}
+	j, _ := json.Marshal(reply)
+	return j
+}
+
+// rejectRTMMessage returns the error ack for `m` if it can't be posted, or nil.
+// `size` is the size of the frame it was sent in
+func (sts *Server) rejectRTMMessage(m slack.OutgoingMessage, size int) []byte {
+	switch {
+	case size > maxRTMMessageSize:
+		return rtmErrorAck(m.ID, rtmErrMessageTooLong, "message too long")
+	case m.Channel == "":
+		return rtmErrorAck(m.ID, rtmErrInvalidChannel, "invalid channel id")
+	case sts.isArchived(m.Channel):
+		return rtmErrorAck(m.ID, rtmErrArchived, "channel is archived")
+	case !sts.rateLimits.allowRTM(m.Channel):
+		return rtmRateLimitedReply(m.ID)
+	}
+	return nil
+}
+
+// rejectPostMessage returns the error for a chat.postMessage call with `values`
+// that can't be posted, or an empty string
+func (sts *Server) rejectPostMessage(values url.Values) string {
+	channel := values.Get("channel")
+	switch {
+	case channel == "":
+		return "channel_not_found"
+	case utf8.RuneCountInString(values.Get("text")) > maxPostMessageLength:
+		return "msg_too_long"
+	case sts.isArchived(channel):
+		return "is_archived"
+	}
+	return ""
+}
+
+// isArchived reports whether `id` is an archived channel or group.
+// Channels the server doesn't know about can be posted to
+func (sts *Server) isArchived(id string) bool {
+	if c, ok := sts.channels.get(id); ok {
+		return c.IsArchived
+	}
+	g, ok := findGroup(sts.GetGroups(), id)
+	return ok && g.IsArchived
+}
@@ -1,6 +1,7 @@
 package slacktest
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -36,6 +37,34 @@ func TestRTMInfo(t *testing.T) {
 	}
 }
 
+func TestRTMInfoWithOptions(t *testing.T) {
+	maxWait := 5 * time.Second
+	s := NewTestServer(WithBotID("U1234567890"), WithTeamID("T1234567890"), WithTeamName("Ghostbusters"))
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	api := slack.New("ABCDEFG")
+	rtm := api.NewRTM()
+	go rtm.ManageConnection()
+	messageChan := make(chan (*slack.ConnectedEvent), 1)
+	go func() {
+		for msg := range rtm.IncomingEvents {
+			switch ev := msg.Data.(type) {
+			case *slack.ConnectedEvent:
+				messageChan <- ev
+			}
+		}
+	}()
+	select {
+	case m := <-messageChan:
+		assert.Equal(t, "U1234567890", m.Info.User.ID, "bot id did not match")
+		assert.Equal(t, "T1234567890", m.Info.Team.ID, "team id did not match")
+		assert.Equal(t, "Ghostbusters", m.Info.Team.Name, "team name did not match")
+		break
+	case <-time.After(maxWait):
+		assert.FailNow(t, "did not get connected event in time")
+	}
+}
+
 func TestRTMPing(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping timered test")
@@ -124,3 +153,148 @@ func TestRTMChannelMessage(t *testing.T) {
 	}
 
 }
+
+func TestRTMThreadReply(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	api := slack.New("ABCDEFG")
+	rtm := api.NewRTM()
+	go rtm.ManageConnection()
+	go func() {
+		for range rtm.IncomingEvents {
+		}
+	}()
+	parentTs := s.SendMessageToChannel("C024BE92L", "parent")
+	rtm.SendMessage(&slack.OutgoingMessage{
+		Channel:         "C024BE92L",
+		Text:            "threaded reply over rtm",
+		Type:            "message",
+		ThreadTimestamp: parentTs,
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.BotRepliedInThread("C024BE92L", parentTs) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, s.BotRepliedInThread("C024BE92L", parentTs), "bot should have replied in thread")
+}
+
+func TestRTMRateLimit(t *testing.T) {
+	maxWait := 5 * time.Second
+	s := NewTestServer(WithRateLimits())
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	api := slack.New("ABCDEFG")
+	rtm := api.NewRTM()
+	go rtm.ManageConnection()
+	errChan := make(chan (*slack.AckErrorEvent), 1)
+	go func() {
+		for msg := range rtm.IncomingEvents {
+			switch ev := msg.Data.(type) {
+			case *slack.AckErrorEvent:
+				errChan <- ev
+			}
+		}
+	}()
+	rtm.SendMessage(rtm.NewOutgoingMessage("first", "C024BE91L"))
+	rtm.SendMessage(rtm.NewOutgoingMessage("too fast", "C024BE91L"))
+	select {
+	case ev := <-errChan:
+		assert.Contains(t, ev.Error(), "rate limit exceeded")
+	case <-time.After(maxWait):
+		assert.FailNow(t, "did not get rate limit error in time")
+	}
+	assert.False(t, s.SawMessage("too fast"), "rate limited message should be dropped")
+}
+
+func TestRTMAck(t *testing.T) {
+	maxWait := 5 * time.Second
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	api := slack.New("ABCDEFG")
+	rtm := api.NewRTM()
+	go rtm.ManageConnection()
+	acks := make(chan (*slack.AckMessage), 1)
+	go func() {
+		for msg := range rtm.IncomingEvents {
+			if ack, ok := msg.Data.(*slack.AckMessage); ok {
+				acks <- ack
+			}
+		}
+	}()
+	out := rtm.NewOutgoingMessage("acknowledge me", "C024BE91L")
+	rtm.SendMessage(out)
+	select {
+	case ack := <-acks:
+		assert.Equal(t, out.ID, ack.ReplyTo)
+		assert.Equal(t, "acknowledge me", ack.Text)
+		m, err := s.GetMessage("C024BE91L", ack.Timestamp)
+		if assert.NoError(t, err, "ack should carry the posted message's ts") {
+			assert.Equal(t, "acknowledge me", m.Text)
+		}
+	case <-time.After(maxWait):
+		assert.FailNow(t, "did not get ack in time")
+	}
+}
+
+func TestRTMMessageIsFromConnectedUser(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddToken("xoxp-observer", s.defaultUser.ID)
+	c := dialAs(t, s, "xoxp-observer")
+	defer func() { _ = c.Close() }()
+	assert.NoError(t, c.WriteJSON(slack.OutgoingMessage{ID: 1, Type: "message", Channel: "C024BE91L", Text: "from a user"}))
+	ack := slack.AckMessage{}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if assert.NoError(t, c.ReadJSON(&ack)) && assert.True(t, ack.Ok) {
+		m, err := s.GetMessage("C024BE91L", ack.Timestamp)
+		if assert.NoError(t, err) {
+			assert.Equal(t, s.defaultUser.ID, m.User, "message should be posted by the user the client authenticated as")
+		}
+	}
+	s.Stop()
+}
+
+func TestRTMErrorAck(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	archived := slack.Channel{}
+	archived.ID = "C0ARCHIVED"
+	archived.Name = "old"
+	archived.IsArchived = true
+	s.AddChannel(archived)
+	c := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = c.Close() }()
+	cases := []struct {
+		msg      slack.OutgoingMessage
+		expected string
+	}{
+		{slack.OutgoingMessage{ID: 1, Type: "message", Text: "nowhere"}, "invalid channel id"},
+		{slack.OutgoingMessage{ID: 2, Type: "message", Channel: "C0ARCHIVED", Text: "archived"}, "channel is archived"},
+		{slack.OutgoingMessage{ID: 3, Type: "message", Channel: "C024BE91L", Text: strings.Repeat("a", maxRTMMessageSize)}, "message too long"},
+	}
+	for _, tc := range cases {
+		assert.NoError(t, c.WriteJSON(tc.msg))
+		ack := slack.AckMessage{}
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if assert.NoError(t, c.ReadJSON(&ack)) {
+			assert.False(t, ack.Ok)
+			assert.Equal(t, tc.msg.ID, ack.ReplyTo)
+			if assert.NotNil(t, ack.Error) {
+				assert.Equal(t, tc.expected, ack.Error.Msg)
+			}
+		}
+	}
+	assert.False(t, s.SawMessage("nowhere"), "rejected messages should not be posted")
+	assert.False(t, s.SawMessage("archived"), "rejected messages should not be posted")
+
+	// channels the server doesn't know about can be posted to
+	assert.NoError(t, c.WriteJSON(slack.OutgoingMessage{ID: 4, Type: "message", Channel: "#general", Text: "unknown"}))
+	ack := slack.AckMessage{}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if assert.NoError(t, c.ReadJSON(&ack)) {
+		assert.True(t, ack.Ok)
+	}
+	s.Stop()
+}
@@ -4,49 +4,138 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"time"
 
+	websocket "github.com/gorilla/websocket"
 	slack "github.com/nlopes/slack"
 )
 
+// stopGrace is how long Stop waits for disconnected clients to reconnect and be parked
+const stopGrace = 500 * time.Millisecond
+
 func newMessageChannels() *messageChannels {
-	sent := make(chan (string))
 	seen := make(chan (string))
 	mc := messageChannels{
-		seen: seen,
-		sent: sent,
+		seen:         seen,
+		seenInbound:  newMessageCollection(),
+		seenOutbound: newMessageCollection(),
 	}
 	return &mc
 }
 
 // NewTestServer returns a slacktest.Server ready to be started
-func NewTestServer() *Server {
+func NewTestServer(opts ...ServerOption) *Server {
 	serverChans := newMessageChannels()
-	seenInboundMessages = &messageCollection{}
-	seenOutboundMessages = &messageCollection{}
-	channels := &serverChannels{}
-	groups := &serverGroups{}
-	s := &Server{}
+	channels := &serverChannels{channels: newDefaultChannels()}
+	groups := &serverGroups{channels: newDefaultGroups()}
+	s := &Server{
+		BotName:     defaultBotName,
+		BotID:       defaultBotID,
+		TeamID:      defaultTeamID,
+		TeamName:    defaultTeamName,
+		TeamDomain:  defaultTeamDomain,
+		defaultUser: newDefaultNonBotUser(),
+		rateLimits:  newServerRateLimits(),
+		connections: newServerConnections(),
+		outbound:    newOutboundQueue(),
+		typing:      &serverTyping{},
+		quit:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
 	mux := http.NewServeMux()
 	mux.Handle("/ws", contextHandler(s, wsHandler))
 	mux.Handle("/rtm.start", contextHandler(s, rtmStartHandler))
+	mux.Handle("/rtm.connect", contextHandler(s, rtmConnectHandler))
 	mux.Handle("/chat.postMessage", contextHandler(s, postMessageHandler))
+	mux.Handle("/chat.update", contextHandler(s, chatUpdateHandler))
+	mux.Handle("/chat.delete", contextHandler(s, chatDeleteHandler))
+	mux.Handle("/reactions.add", contextHandler(s, reactionsAddHandler))
+	mux.Handle("/reactions.remove", contextHandler(s, reactionsRemoveHandler))
+	mux.Handle("/reactions.get", contextHandler(s, reactionsGetHandler))
+	mux.Handle("/reactions.list", contextHandler(s, reactionsListHandler))
+	mux.Handle("/channels.replies", contextHandler(s, channelsRepliesHandler))
+	mux.Handle("/conversations.replies", contextHandler(s, conversationsRepliesHandler))
 	mux.Handle("/channels.list", contextHandler(s, listChannelsHandler))
 	mux.Handle("/groups.list", contextHandler(s, listGroupsHandler))
+	mux.Handle("/channels.info", contextHandler(s, channelsInfoHandler))
+	mux.Handle("/groups.info", contextHandler(s, groupsInfoHandler))
+	mux.Handle("/channels.create", contextHandler(s, channelsCreateHandler))
+	mux.Handle("/channels.archive", contextHandler(s, channelsArchiveHandler))
+	mux.Handle("/channels.unarchive", contextHandler(s, channelsUnarchiveHandler))
+	mux.Handle("/channels.rename", contextHandler(s, channelsRenameHandler))
+	mux.Handle("/channels.invite", contextHandler(s, channelsInviteHandler))
+	mux.Handle("/channels.kick", contextHandler(s, channelsKickHandler))
+	mux.Handle("/channels.join", contextHandler(s, channelsJoinHandler))
+	mux.Handle("/channels.leave", contextHandler(s, channelsLeaveHandler))
+	mux.Handle("/channels.setTopic", contextHandler(s, channelsSetTopicHandler))
+	mux.Handle("/channels.setPurpose", contextHandler(s, channelsSetPurposeHandler))
 	mux.Handle("/users.info", contextHandler(s, usersInfoHandler))
+	mux.Handle("/users.list", contextHandler(s, usersListHandler))
+	mux.Handle("/users.getPresence", contextHandler(s, usersGetPresenceHandler))
+	mux.Handle("/users.profile.get", contextHandler(s, usersProfileGetHandler))
 	mux.Handle("/bots.info", contextHandler(s, botsInfoHandler))
-	httpserver := httptest.NewUnstartedServer(mux)
+	mux.Handle("/auth.test", contextHandler(s, authTestHandler))
+	mux.Handle("/channels.history", contextHandler(s, channelsHistoryHandler))
+	mux.Handle("/groups.history", contextHandler(s, groupsHistoryHandler))
+	mux.Handle("/conversations.history", contextHandler(s, conversationsHistoryHandler))
+	mux.Handle("/im.open", contextHandler(s, imOpenHandler))
+	mux.Handle("/im.close", contextHandler(s, imCloseHandler))
+	mux.Handle("/im.list", contextHandler(s, imListHandler))
+	mux.Handle("/im.history", contextHandler(s, imHistoryHandler))
+	mux.Handle("/im.mark", contextHandler(s, imMarkHandler))
+	mux.Handle("/mpim.open", contextHandler(s, mpimOpenHandler))
+	mux.Handle("/mpim.list", contextHandler(s, mpimListHandler))
+	mux.Handle("/mpim.history", contextHandler(s, mpimHistoryHandler))
+	mux.Handle("/conversations.open", contextHandler(s, conversationsOpenHandler))
+	mux.Handle("/conversations.list", contextHandler(s, conversationsListHandler))
+	mux.Handle("/conversations.info", contextHandler(s, conversationsInfoHandler))
+	mux.Handle("/conversations.members", contextHandler(s, conversationsMembersHandler))
+	mux.Handle("/conversations.create", contextHandler(s, conversationsCreateHandler))
+	mux.Handle("/conversations.join", contextHandler(s, conversationsJoinHandler))
+	mux.Handle("/conversations.invite", contextHandler(s, conversationsInviteHandler))
+	mux.Handle("/files.upload", contextHandler(s, filesUploadHandler))
+	mux.Handle("/files.info", contextHandler(s, filesInfoHandler))
+	mux.Handle("/files.list", contextHandler(s, filesListHandler))
+	mux.Handle("/files.delete", contextHandler(s, filesDeleteHandler))
+	mux.Handle("/files.sharedPublicURL", contextHandler(s, filesSharedPublicURLHandler))
+	mux.Handle(filesPath, contextHandler(s, fileContentHandler))
+	httpserver := httptest.NewUnstartedServer(journalHandler(s, latencyHandler(s, faultHandler(s, rateLimitHandler(s, mux)))))
+	if s.listenAddr != "" {
+		l, lErr := net.Listen("tcp", s.listenAddr)
+		if lErr != nil {
+			// like httptest, fail loudly rather than serve somewhere the test isn't looking
+			_ = httpserver.Listener.Close()
+			panic(fmt.Sprintf("slacktest: failed to listen on %s: %s", s.listenAddr, lErr.Error()))
+		}
+		_ = httpserver.Listener.Close()
+		httpserver.Listener = l
+	}
 	addr := httpserver.Listener.Addr().String()
 
 	s.ServerAddr = addr
 	s.server = httpserver
-	s.BotName = defaultBotName
-	s.BotID = defaultBotID
 	s.SeenFeed = serverChans.seen
 	s.channels = channels
 	s.groups = groups
+	s.messages = &serverMessages{}
+	s.files = &serverFiles{}
+	s.ims = &serverIMs{}
+	s.ims.add(defaultIMID, s.BotID, s.defaultUser.ID)
+	s.mpims = &serverMPIMs{}
+	s.apiCalls = &apiJournal{}
+	s.faults = &serverFaults{}
+	s.latencies = newServerLatencies()
+	s.users = &serverUsers{users: []slack.User{s.defaultUser, newBotUser(s.BotID, s.BotName)}}
+	s.seenInboundMessages = serverChans.seenInbound
+	s.seenOutboundMessages = serverChans.seenOutbound
+	s.outbound.clients = func() int { return len(s.ConnectedClients()) }
+	serverChans.outbound = s.outbound
+	go s.dispatchOutbound(s.outbound, s.quit)
 	addErr := addServerToHub(s, serverChans)
 	if addErr != nil {
 		log.Printf("Unable to add server to hub: %s", addErr.Error())
@@ -56,82 +145,161 @@ func NewTestServer() *Server {
 
 // GetChannels returns all the fake channels registered
 func (sts *Server) GetChannels() []slack.Channel {
-	sts.channels.RLock()
-	defer sts.channels.RUnlock()
-	return sts.channels.channels
+	return sts.channels.all()
 }
 
 // GetGroups returns all the fake groups registered
 func (sts *Server) GetGroups() []slack.Group {
-	return sts.groups.channels
+	return sts.groups.all()
 }
 
-/*
-// These are placeholders for now
-// AddChannel adds a new fake channel
+// AddChannel adds a new fake channel or replaces the one with the same id
 func (sts *Server) AddChannel(c slack.Channel) {
-	sts.channels.Lock()
-	sts.channels.channels = append(sts.channels.channels, c)
-	sts.channels.Unlock()
+	sts.channels.add(c)
+}
+
+// AddGroup adds a new fake group or replaces the one with the same id
+func (sts *Server) AddGroup(g slack.Group) {
+	sts.groups.add(g)
+}
+
+// RemoveChannel removes the fake channel with the given id
+func (sts *Server) RemoveChannel(id string) error {
+	if !sts.channels.remove(id) {
+		return ErrChannelNotFound
+	}
+	return nil
+}
+
+// RemoveGroup removes the fake group with the given id
+func (sts *Server) RemoveGroup(id string) error {
+	if !sts.groups.remove(id) {
+		return ErrChannelNotFound
+	}
+	return nil
+}
+
+// SetChannelMembers replaces the members of a channel or group
+func (sts *Server) SetChannelMembers(id string, members []string) error {
+	members = append([]string(nil), members...)
+	if sts.channels.update(id, func(c *slack.Channel) { c.Members = members }) {
+		return nil
+	}
+	if sts.groups.update(id, func(g *slack.Group) { g.Members = members }) {
+		return nil
+	}
+	return ErrChannelNotFound
+}
+
+// SetChannelTopic sets the topic of a channel or group as the default user
+func (sts *Server) SetChannelTopic(id, topic string) error {
+	t := slack.Topic{
+		Value:   topic,
+		Creator: sts.defaultUser.ID,
+		LastSet: nowAsJSONTime(),
+	}
+	if sts.channels.update(id, func(c *slack.Channel) { c.Topic = t }) {
+		return nil
+	}
+	if sts.groups.update(id, func(g *slack.Group) { g.Topic = t }) {
+		return nil
+	}
+	return ErrChannelNotFound
+}
+
+// SetChannelPurpose sets the purpose of a channel or group as the default user
+func (sts *Server) SetChannelPurpose(id, purpose string) error {
+	p := slack.Purpose{
+		Value:   purpose,
+		Creator: sts.defaultUser.ID,
+		LastSet: nowAsJSONTime(),
+	}
+	if sts.channels.update(id, func(c *slack.Channel) { c.Purpose = p }) {
+		return nil
+	}
+	if sts.groups.update(id, func(g *slack.Group) { g.Purpose = p }) {
+		return nil
+	}
+	return ErrChannelNotFound
+}
+
+// GetUsers returns all the fake users registered
+func (sts *Server) GetUsers() []slack.User {
+	return sts.users.all()
+}
+
+// AddUser adds a new fake user or replaces the one with the same id
+func (sts *Server) AddUser(u slack.User) {
+	sts.users.add(u)
+}
+
+// SetUserPresence sets the presence (`active` or `away`) of a user
+func (sts *Server) SetUserPresence(id, presence string) error {
+	if !sts.users.update(id, func(u *slack.User) { u.Presence = presence }) {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetMessage returns a message the server knows about by channel and timestamp
+func (sts *Server) GetMessage(channel, ts string) (slack.Message, error) {
+	m, ok := sts.messages.get(channel, ts)
+	if !ok {
+		return slack.Message{}, ErrMessageNotFound
+	}
+	return m, nil
 }
 
-// AddGroup adds a new fake group
-func (sts *Server) AddGroup(c slack.Group) {
-	sts.groups.Lock()
-	sts.groups.channels = append(sts.groups.channels, c)
-	sts.groups.Unlock()
+// GetMessageEdits returns the previous versions of a message, oldest first
+func (sts *Server) GetMessageEdits(channel, ts string) ([]slack.Message, error) {
+	edits, ok := sts.messages.edits(channel, ts)
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	return edits, nil
+}
+
+// GetThreadReplies returns the replies to the thread started by the message `threadTS`, oldest first
+func (sts *Server) GetThreadReplies(channel, threadTS string) ([]slack.Message, error) {
+	messages, ok := sts.messages.thread(channel, threadTS)
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	return messages[1:], nil
+}
+
+// BotRepliedInThread checks if the bot replied to the thread started by the message `threadTS`
+func (sts *Server) BotRepliedInThread(channel, threadTS string) bool {
+	replies, err := sts.GetThreadReplies(channel, threadTS)
+	if err != nil {
+		return false
+	}
+	for _, r := range replies {
+		if r.User == sts.BotID {
+			return true
+		}
+	}
+	return false
 }
-*/
 
 // GetSeenInboundMessages returns all messages seen via websocket excluding pings
 func (sts *Server) GetSeenInboundMessages() []string {
-	seenInboundMessages.RLock()
-	m := seenInboundMessages.messages
-	seenInboundMessages.RUnlock()
-	return m
+	return sts.seenInboundMessages.all()
 }
 
 // GetSeenOutboundMessages returns all messages seen via websocket excluding pings
 func (sts *Server) GetSeenOutboundMessages() []string {
-	seenOutboundMessages.RLock()
-	m := seenOutboundMessages.messages
-	seenOutboundMessages.RUnlock()
-	return m
+	return sts.seenOutboundMessages.all()
 }
 
 // SawOutgoingMessage checks if a message was sent to connected websocket clients
 func (sts *Server) SawOutgoingMessage(msg string) bool {
-	seenOutboundMessages.RLock()
-	defer seenOutboundMessages.RUnlock()
-	for _, m := range seenOutboundMessages.messages {
-		evt := &slack.MessageEvent{}
-		jErr := json.Unmarshal([]byte(m), evt)
-		if jErr != nil {
-			continue
-		}
-		if evt.Text == msg {
-			return true
-		}
-	}
-	return false
+	return sts.seenOutboundMessages.hasMessageText(msg)
 }
 
 // SawMessage checks if an incoming message was seen
 func (sts *Server) SawMessage(msg string) bool {
-	seenInboundMessages.RLock()
-	defer seenInboundMessages.RUnlock()
-	for _, m := range seenInboundMessages.messages {
-		evt := &slack.MessageEvent{}
-		jErr := json.Unmarshal([]byte(m), evt)
-		if jErr != nil {
-			// This event isn't a message event so we'll skip it
-			continue
-		}
-		if evt.Text == msg {
-			return true
-		}
-	}
-	return false
+	return sts.seenInboundMessages.hasMessageText(msg)
 }
 
 // GetAPIURL returns the api url you can pass to slack.SLACK_API
@@ -146,6 +314,16 @@ func (sts *Server) GetWSURL() string {
 
 // Stop stops the test server
 func (sts *Server) Stop() {
+	sts.quitOnce.Do(func() { close(sts.quit) })
+	// clients like slack.RTM reconnect when they are disconnected and would find the next
+	// test's server through slack.SLACK_API, so they're left parked on a silent connection instead
+	answered := sts.connections.retire()
+	// websocket connections are hijacked so closing the http server won't close them
+	sts.DisconnectClients(websocket.CloseGoingAway, "server stopped")
+	select {
+	case <-answered:
+	case <-time.After(stopGrace):
+	}
 	sts.server.Close()
 }
 
@@ -155,64 +333,84 @@ func (sts *Server) Start() {
 	sts.server.Start()
 }
 
-// SendMessageToBot sends a message addressed to the Bot
-func (sts *Server) SendMessageToBot(channel, msg string) {
+// SendMessageToBot sends a message addressed to the Bot and returns its timestamp
+func (sts *Server) SendMessageToBot(channel, msg string) string {
 	m := slack.Message{}
 	m.Type = slack.TYPE_MESSAGE
 	m.Channel = channel
-	m.User = defaultNonBotUserID
+	m.User = sts.defaultUser.ID
 	m.Text = fmt.Sprintf("<@%s> %s", sts.BotID, msg)
-	m.Timestamp = fmt.Sprintf("%d", time.Now().Unix())
-	j, jErr := json.Marshal(m)
-	if jErr != nil {
-		log.Printf("Unable to marshal message for bot: %s", jErr.Error())
-		return
+	m.Timestamp = newTimestamp()
+	return sts.sendUserMessage(m)
+}
+
+// SendDirectMessageToBot sends a direct message from the default user to the bot and returns its timestamp
+func (sts *Server) SendDirectMessageToBot(msg string) string {
+	ts, err := sts.SendDirectMessageToBotFromUser(sts.defaultUser.ID, msg)
+	if err != nil {
+		log.Printf("Unable to send direct message to bot: %s", err.Error())
 	}
-	go queueForWebsocket(string(j), sts.ServerAddr)
+	return ts
 }
 
-// SendDirectMessageToBot sends a direct message to the bot
-func (sts *Server) SendDirectMessageToBot(msg string) {
+// SendMessageToChannel sends a message to a channel and returns its timestamp
+func (sts *Server) SendMessageToChannel(channel, msg string) string {
 	m := slack.Message{}
 	m.Type = slack.TYPE_MESSAGE
-	m.Channel = "D024BE91L"
-	m.User = defaultNonBotUserID
+	m.Channel = channel
 	m.Text = msg
-	m.Timestamp = fmt.Sprintf("%d", time.Now().Unix())
-	j, jErr := json.Marshal(m)
-	if jErr != nil {
-		log.Printf("Unable to marshal private message for bot: %s", jErr.Error())
-		return
-	}
-	go queueForWebsocket(string(j), sts.ServerAddr)
+	m.User = sts.defaultUser.ID
+	m.Timestamp = newTimestamp()
+	return sts.sendUserMessage(m)
 }
 
-// SendMessageToChannel sends a message to a channel
-func (sts *Server) SendMessageToChannel(channel, msg string) {
+// SendThreadReplyToChannel replies to the thread started by the message `threadTS`
+// in a channel and returns the timestamp of the reply
+func (sts *Server) SendThreadReplyToChannel(channel, threadTS, msg string) string {
 	m := slack.Message{}
 	m.Type = slack.TYPE_MESSAGE
 	m.Channel = channel
 	m.Text = msg
-	m.User = defaultNonBotUserID
-	m.Timestamp = fmt.Sprintf("%d", time.Now().Unix())
+	m.User = sts.defaultUser.ID
+	m.Timestamp = newTimestamp()
+	m.ThreadTimestamp = threadTS
+	return sts.sendUserMessage(m)
+}
+
+// sendUserMessage records a message from a human user and sends it to connected clients
+func (sts *Server) sendUserMessage(m slack.Message) string {
+	m, replied := sts.recordMessage(m, m.User)
 	j, jErr := json.Marshal(m)
 	if jErr != nil {
 		log.Printf("Unable to marshal message for channel: %s", jErr.Error())
-		return
+		return m.Timestamp
 	}
-	stringMsg := string(j)
-	go queueForWebsocket(stringMsg, sts.ServerAddr)
+	_ = queueForWebsocket(string(j), sts.ServerAddr, SourceServer)
+	// slack sends the reply before telling clients the thread changed
+	queueReplied(replied, sts.ServerAddr, SourceServer)
+	return m.Timestamp
 }
 
 // SendToWebsocket send `s` as is to connected clients.
-// This is useful for sending your own custom json to the websocket
-func (sts *Server) SendToWebsocket(s string) {
-	go queueForWebsocket(s, sts.ServerAddr)
+// This is useful for sending your own custom json to the websocket.
+// It returns an error if the event couldn't be queued for delivery
+func (sts *Server) SendToWebsocket(s string) error {
+	return queueForWebsocket(s, sts.ServerAddr, SourceServer)
 }
 
 // SetBotName sets a custom botname
 func (sts *Server) SetBotName(b string) {
 	sts.BotName = b
+	sts.users.update(sts.BotID, func(u *slack.User) { u.Name = b })
+}
+
+// GetTeam returns the team the bot belongs to
+func (sts *Server) GetTeam() *slack.Team {
+	return &slack.Team{
+		ID:     sts.TeamID,
+		Name:   sts.TeamName,
+		Domain: sts.TeamDomain,
+	}
 }
 
 // SendBotChannelInvite invites the bot to a channel
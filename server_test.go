@@ -1,6 +1,7 @@
 package slacktest
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
@@ -24,32 +25,68 @@ func TestCustomNewServer(t *testing.T) {
 	assert.Equal(t, "BobsBot", s.BotName)
 }
 
+func TestNewServerWithOptions(t *testing.T) {
+	u := slack.User{ID: "W999999", Name: "venkman", RealName: "Peter Venkman"}
+	s := NewTestServer(
+		WithBotID("U1234567890"),
+		WithBotName("BobsBot"),
+		WithTeamID("T1234567890"),
+		WithTeamName("Ghostbusters"),
+		WithTeamDomain("ghostbusters"),
+		WithDefaultUser(u),
+		WithListenAddress("127.0.0.1:0"),
+	)
+	assert.Equal(t, "U1234567890", s.BotID)
+	assert.Equal(t, "BobsBot", s.BotName)
+	assert.Equal(t, "T1234567890", s.GetTeam().ID)
+	assert.Equal(t, "Ghostbusters", s.GetTeam().Name)
+	assert.Equal(t, "ghostbusters", s.GetTeam().Domain)
+	assert.Equal(t, u, s.defaultUser)
+	assert.NotEmpty(t, s.ServerAddr)
+	s.Stop()
+}
+
+func TestListenAddressInUse(t *testing.T) {
+	s := NewTestServer()
+	defer s.Stop()
+	assert.Panics(t, func() { NewTestServer(WithListenAddress(s.ServerAddr)) }, "a server that can't listen where asked should fail loudly")
+}
+
 func TestServerSendMessageToChannel(t *testing.T) {
 	s := NewTestServer()
-	go s.Start()
+	s.Start()
 	s.SendMessageToChannel("C123456789", t.Name())
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, MessageWithText(t.Name()))
+	assert.NoError(t, err)
 	assert.True(t, s.SawOutgoingMessage(t.Name()))
 	s.Stop()
 }
 
 func TestServerSendMessageToBot(t *testing.T) {
 	s := NewTestServer()
-	go s.Start()
+	s.Start()
 	s.SendMessageToBot("C123456789", t.Name())
 	expectedMsg := fmt.Sprintf("<@%s> %s", s.BotID, t.Name())
-	time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, MessageWithText(expectedMsg))
+	assert.NoError(t, err)
 	assert.True(t, s.SawOutgoingMessage(expectedMsg))
 	s.Stop()
 }
 
 func TestBotDirectMessageBotHandler(t *testing.T) {
 	s := NewTestServer()
-	go s.Start()
+	s.Start()
 	slack.SLACK_API = s.GetAPIURL()
 	s.SendDirectMessageToBot(t.Name())
-	expectedMsg := fmt.Sprintf(t.Name())
-	time.Sleep(2)
+	expectedMsg := t.Name()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, MessageWithText(expectedMsg))
+	assert.NoError(t, err)
 	assert.True(t, s.SawOutgoingMessage(expectedMsg))
 	s.Stop()
 }
@@ -60,7 +97,10 @@ func TestGetSeenOutboundMessages(t *testing.T) {
 	go s.Start()
 	slack.SLACK_API = s.GetAPIURL()
 	s.SendMessageToChannel("foo", "should see this message")
-	time.Sleep(maxWait)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	_, err := s.WaitForOutbound(ctx, MessageWithText("should see this message"))
+	assert.NoError(t, err)
 	seenOutbound := s.GetSeenOutboundMessages()
 	assert.True(t, len(seenOutbound) > 0)
 	hadMessage := false
@@ -88,7 +128,13 @@ func TestGetSeenInboundMessages(t *testing.T) {
 		Channel: "foo",
 		Text:    "should see this inbound message",
 	})
-	time.Sleep(maxWait)
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	evt, err := s.WaitForMessage(ctx, MessageWithText("should see this inbound message"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, evt) {
+		assert.Equal(t, "foo", evt.Channel)
+	}
 	seenInbound := s.GetSeenInboundMessages()
 	assert.True(t, len(seenInbound) > 0)
 	hadMessage := false
@@ -121,7 +167,6 @@ func TestSendChannelInvite(t *testing.T) {
 		}
 	}()
 	s.SendBotChannelInvite()
-	time.Sleep(maxWait)
 	select {
 	case m := <-evChan:
 		assert.Equal(t, "C024BE92L", m.ID, "channel id should match")
@@ -150,7 +195,6 @@ func TestSendGroupInvite(t *testing.T) {
 		}
 	}()
 	s.SendBotGroupInvite()
-	time.Sleep(maxWait)
 	select {
 	case m := <-evChan:
 		assert.Equal(t, "G024BE91L", m.ID, "channel id should match")
@@ -163,6 +207,69 @@ func TestSendGroupInvite(t *testing.T) {
 
 }
 
+func TestServersRecordSeparately(t *testing.T) {
+	s1 := NewTestServer()
+	go s1.Start()
+	s2 := NewTestServer()
+	go s2.Start()
+	s1.SendMessageToChannel("C123456789", t.Name())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s1.WaitForOutbound(ctx, MessageWithText(t.Name()))
+	assert.NoError(t, err)
+	assert.True(t, s1.SawOutgoingMessage(t.Name()), "first server should have seen the message")
+	assert.False(t, s2.SawOutgoingMessage(t.Name()), "second server should not have seen the message")
+	assert.Len(t, s2.GetSeenOutboundMessages(), 0, "second server should have no outbound messages")
+	s3 := NewTestServer()
+	assert.True(t, s1.SawOutgoingMessage(t.Name()), "creating a new server should not reset existing servers")
+	s3.Stop()
+}
+
+func TestServerWorkspaceChannels(t *testing.T) {
+	s := NewTestServer()
+	assert.Len(t, s.GetChannels(), 2)
+	assert.Len(t, s.GetGroups(), 1)
+	channels := s.GetChannels()
+	channels[0].Members[0] = "changed"
+	assert.Equal(t, "W012A3CDE", s.GetChannels()[0].Members[0], "returned channels should be copies")
+	assert.EqualError(t, s.RemoveChannel("C999999999"), ErrChannelNotFound.Error())
+	assert.EqualError(t, s.RemoveGroup("G999999999"), ErrChannelNotFound.Error())
+	assert.EqualError(t, s.SetChannelTopic("C999999999", "foo"), ErrChannelNotFound.Error())
+	assert.EqualError(t, s.SetChannelPurpose("C999999999", "foo"), ErrChannelNotFound.Error())
+	assert.EqualError(t, s.SetChannelMembers("C999999999", nil), ErrChannelNotFound.Error())
+	s.Stop()
+}
+
+func TestServerWaitForOutboundTimeout(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.SendMessageToChannel("C123456789", "some other message")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	evt, err := s.WaitForOutbound(ctx, MessageWithText(t.Name()))
+	assert.Nil(t, evt)
+	assert.EqualError(t, err, context.DeadlineExceeded.Error())
+	s.Stop()
+}
+
+func TestServerWaitForOutboundMatchers(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.SendMessageToChannel("C123456789", t.Name())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.SendMessageToChannel("C987654321", t.Name())
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	evt, err := s.WaitForOutbound(ctx, AllOf(MessageInChannel("C987654321"), MessageWithText(t.Name())))
+	assert.NoError(t, err)
+	if assert.NotNil(t, evt) {
+		assert.Equal(t, "C987654321", evt.Channel)
+	}
+	s.Stop()
+}
+
 func TestServerSawMessage(t *testing.T) {
 	s := NewTestServer()
 	go s.Start()
@@ -2,11 +2,45 @@ package slacktest
 
 import (
 	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
 
 	slackbot "github.com/lusis/go-slackbot"
 	slack "github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
 )
 
 func testSlackBotEchoHandler(ctx context.Context, b *slackbot.Bot, evt *slack.MessageEvent) {
 	b.Reply(evt, "bot saw: "+evt.Text, slackbot.WithoutTyping)
 }
+
+// waitForOutbound waits up to a second for a message matching `f` to be queued for websocket clients
+func waitForOutbound(s *Server, f func(string) bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, m := range s.GetSeenOutboundMessages() {
+			if f(m) {
+				return true
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// waitForOutboundType waits up to a second for an event of type `t` to be queued for websocket clients
+func waitForOutboundType(s *Server, t string) bool {
+	return waitForOutbound(s, func(m string) bool {
+		evt := slack.Event{}
+		return json.Unmarshal([]byte(m), &evt) == nil && evt.Type == t
+	})
+}
+
+// postDecode calls the api `method` with `values` and decodes the json response into `v`
+func postDecode(t *testing.T, s *Server, method string, values url.Values, v interface{}) {
+	resp := postStatus(t, s, method, values)
+	defer func() { _ = resp.Body.Close() }()
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
@@ -23,17 +23,26 @@ var ServerBotNameContextKey contextKey = "__SERVER_BOTNAME__"
 // ServerBotIDContextKey is the bot userid
 var ServerBotIDContextKey contextKey = "__SERVER_BOTID__"
 
+// ServerTeamContextKey is the team the bot belongs to
+var ServerTeamContextKey contextKey = "__SERVER_TEAM__"
+
+// ServerDefaultUserContextKey is the human user messages are sent as by default
+var ServerDefaultUserContextKey contextKey = "__SERVER_DEFAULT_USER__"
+
 // ServerBotChannelsContextKey is the list of channels associated with the fake server
 var ServerBotChannelsContextKey contextKey = "__SERVER_CHANNELS__"
 
 // ServerBotGroupsContextKey is the list of channels associated with the fake server
 var ServerBotGroupsContextKey contextKey = "__SERVER_GROUPS__"
 
+// ServerUsersContextKey is the list of users associated with the fake server
+var ServerUsersContextKey contextKey = "__SERVER_USERS__"
+
 // ServerBotHubNameContextKey is the context key for passing along the server name registered in the hub
 var ServerBotHubNameContextKey contextKey = "__SERVER_HUBNAME__"
 
-var seenInboundMessages *messageCollection
-var seenOutboundMessages *messageCollection
+// serverContextKey is the context key for the Server handling a request
+var serverContextKey contextKey = "__SERVER__"
 
 var masterHub = newHub()
 
@@ -43,13 +52,17 @@ type hub struct {
 }
 
 type messageChannels struct {
-	seen   chan (string)
-	sent   chan (string)
-	posted chan (slack.Message)
+	seen         chan (string)
+	outbound     *outboundQueue
+	posted       chan (slack.Message)
+	seenInbound  *messageCollection
+	seenOutbound *messageCollection
 }
 type messageCollection struct {
 	sync.RWMutex
-	messages []string
+	messages []RecordedEvent
+	// changed is closed and replaced every time a message is added
+	changed chan struct{}
 }
 
 type serverChannels struct {
@@ -62,20 +75,148 @@ type serverGroups struct {
 	channels []slack.Group
 }
 
+type storedMessage struct {
+	message  slack.Message
+	postedBy string
+	edits    []slack.Message
+}
+
+type serverMessages struct {
+	sync.RWMutex
+	messages []*storedMessage
+}
+
+type serverUsers struct {
+	sync.RWMutex
+	users []slack.User
+}
+
 // Server represents a Slack Test server
 type Server struct {
-	server     *httptest.Server
-	mux        *http.ServeMux
-	Logger     *log.Logger
-	BotName    string
-	BotID      string
-	ServerAddr string
-	SeenFeed   chan (string)
-	channels   *serverChannels
-	groups     *serverGroups
+	server               *httptest.Server
+	mux                  *http.ServeMux
+	Logger               *log.Logger
+	BotName              string
+	BotID                string
+	TeamID               string
+	TeamName             string
+	TeamDomain           string
+	ServerAddr           string
+	SeenFeed             chan (string)
+	channels             *serverChannels
+	groups               *serverGroups
+	users                *serverUsers
+	messages             *serverMessages
+	seenInboundMessages  *messageCollection
+	seenOutboundMessages *messageCollection
+	apiCalls             *apiJournal
+	faults               *serverFaults
+	rateLimits           *serverRateLimits
+	latencies            *serverLatencies
+	connections          *serverConnections
+	outbound             *outboundQueue
+	typing               *serverTyping
+	files                *serverFiles
+	ims                  *serverIMs
+	mpims                *serverMPIMs
+	defaultUser          slack.User
+	listenAddr           string
+	// quit is closed when the server is stopped
+	quit     chan struct{}
+	quitOnce sync.Once
 }
 
 type fullInfoSlackResponse struct {
 	slack.Info
 	slack.WebResponse
+	// MPIMs is only sent to clients that start with mpim_aware
+	MPIMs []mpimChannel `json:"mpims,omitempty"`
+}
+
+// mpimChannel is a multi-party direct message. Slack sends them as groups with is_mpim set
+type mpimChannel struct {
+	slack.Group
+	IsMpim bool `json:"is_mpim"`
+}
+
+// conversationInfo is a public or private channel, direct message or multi-party direct message
+// as the conversations.* methods describe it
+type conversationInfo struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name,omitempty"`
+	Created    slack.JSONTime `json:"created"`
+	Creator    string         `json:"creator,omitempty"`
+	IsChannel  bool           `json:"is_channel"`
+	IsGroup    bool           `json:"is_group"`
+	IsIM       bool           `json:"is_im"`
+	IsMpim     bool           `json:"is_mpim"`
+	IsPrivate  bool           `json:"is_private"`
+	IsArchived bool           `json:"is_archived"`
+	IsGeneral  bool           `json:"is_general"`
+	IsMember   bool           `json:"is_member"`
+	IsOpen     bool           `json:"is_open,omitempty"`
+	// User is the other member of a direct message
+	User       string         `json:"user,omitempty"`
+	Topic      *slack.Topic   `json:"topic,omitempty"`
+	Purpose    *slack.Purpose `json:"purpose,omitempty"`
+	NumMembers int            `json:"num_members"`
+	// members is paged through by conversations.members rather than sent
+	members []string
+}
+
+// groupJoinedEvent is sent when the bot joins a private channel
+type groupJoinedEvent struct {
+	Type    string      `json:"type"`
+	Channel slack.Group `json:"channel"`
+}
+
+// mpimJoinedEvent is sent when the bot is added to a multi-party direct message
+type mpimJoinedEvent struct {
+	Type    string      `json:"type"`
+	Channel mpimChannel `json:"channel"`
+}
+
+type responseMetadata struct {
+	NextCursor string `json:"next_cursor"`
+}
+
+// memberJoinedChannelEvent is sent when a user joins a channel
+type memberJoinedChannelEvent struct {
+	Type        string `json:"type"`
+	User        string `json:"user"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	Team        string `json:"team"`
+	Inviter     string `json:"inviter,omitempty"`
+}
+
+// memberLeftChannelEvent is sent when a user leaves or is removed from a channel
+type memberLeftChannelEvent struct {
+	Type        string `json:"type"`
+	User        string `json:"user"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	Team        string `json:"team"`
+}
+
+// fileRef is how file events refer to a file
+type fileRef struct {
+	ID string `json:"id"`
+}
+
+// fileEvent is sent when a file is created, shared, made public or deleted
+type fileEvent struct {
+	Type           string  `json:"type"`
+	FileID         string  `json:"file_id"`
+	File           fileRef `json:"file"`
+	UserID         string  `json:"user_id,omitempty"`
+	ChannelID      string  `json:"channel_id,omitempty"`
+	EventTimestamp string  `json:"event_ts"`
+}
+
+// messageChangedEvent is sent when a message is edited or deleted
+type messageChangedEvent struct {
+	slack.Msg
+	SubMessage      *slack.Msg `json:"message,omitempty"`
+	PreviousMessage *slack.Msg `json:"previous_message,omitempty"`
 }
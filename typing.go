@@ -0,0 +1,110 @@
+package slacktest
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	slack "github.com/nlopes/slack"
+)
+
+// TypingIndicator is a `typing` event a websocket client sent
+type TypingIndicator struct {
+	Channel string
+	// User is who the client authenticated as
+	User string
+	// ConnectionID is the id of the client that sent it
+	ConnectionID string
+	ReceivedAt   time.Time
+}
+
+type serverTyping struct {
+	sync.RWMutex
+	indicators []TypingIndicator
+	// relay sends user_typing to the other clients when set
+	relay bool
+}
+
+func (st *serverTyping) add(ti TypingIndicator) {
+	st.Lock()
+	st.indicators = append(st.indicators, ti)
+	st.Unlock()
+}
+
+// inChannel returns the indicators sent to `channel`, or every indicator if it's empty
+func (st *serverTyping) inChannel(channel string) []TypingIndicator {
+	st.RLock()
+	defer st.RUnlock()
+	indicators := []TypingIndicator{}
+	for _, ti := range st.indicators {
+		if channel == "" || ti.Channel == channel {
+			indicators = append(indicators, ti)
+		}
+	}
+	return indicators
+}
+
+func (st *serverTyping) relaying() bool {
+	st.RLock()
+	defer st.RUnlock()
+	return st.relay
+}
+
+// recordTyping stores the typing event `data` sent by `rc` and relays it if enabled
+func (sts *Server) recordTyping(rc *rtmConnection, data []byte) error {
+	out := slack.OutgoingMessage{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+	sts.typing.add(TypingIndicator{
+		Channel:      out.Channel,
+		User:         rc.user,
+		ConnectionID: rc.id,
+		ReceivedAt:   time.Now(),
+	})
+	if sts.typing.relaying() {
+		queueEventForWebsocket(slack.UserTypingEvent{
+			Type:    "user_typing",
+			User:    rc.user,
+			Channel: out.Channel,
+		}, sts.ServerAddr, SourceRTM)
+	}
+	return nil
+}
+
+// GetTypingIndicators returns the typing events clients sent to `channel` in the order they were received.
+// An empty `channel` returns every typing event
+func (sts *Server) GetTypingIndicators(channel string) []TypingIndicator {
+	return sts.typing.inChannel(channel)
+}
+
+// BotTyped checks if the bot sent a typing event to `channel`
+func (sts *Server) BotTyped(channel string) bool {
+	for _, ti := range sts.typing.inChannel(channel) {
+		if ti.User == sts.BotID {
+			return true
+		}
+	}
+	return false
+}
+
+// BotTypedBeforeReplying checks if the bot sent a typing event to `channel`
+// before posting a message there
+func (sts *Server) BotTypedBeforeReplying(channel string) bool {
+	var typed []time.Time
+	for _, ti := range sts.typing.inChannel(channel) {
+		if ti.User == sts.BotID {
+			typed = append(typed, ti.ReceivedAt)
+		}
+	}
+	if len(typed) == 0 {
+		return false
+	}
+	for _, m := range sts.messages.postedBy(channel, sts.BotID) {
+		posted, ok := timestampTime(m.Timestamp)
+		if ok && !posted.Before(typed[0]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package slacktest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotTypedBeforeReplying(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	rtm := slack.New("ABCDEFG").NewRTM()
+	go rtm.ManageConnection()
+	go func() {
+		for range rtm.IncomingEvents {
+		}
+	}()
+	rtm.SendMessage(rtm.NewOutgoingMessage("not typed", "C024BE92L"))
+	rtm.SendMessage(rtm.NewTypingMessage("C024BE91L"))
+	rtm.SendMessage(rtm.NewOutgoingMessage("typed first", "C024BE91L"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.WaitForMessage(ctx, MessageWithText("typed first"))
+	assert.NoError(t, err)
+	indicators := s.GetTypingIndicators("C024BE91L")
+	if assert.Len(t, indicators, 1) {
+		assert.Equal(t, s.BotID, indicators[0].User)
+		assert.Contains(t, s.ConnectedClients(), indicators[0].ConnectionID)
+	}
+	assert.True(t, s.BotTyped("C024BE91L"))
+	assert.True(t, s.BotTypedBeforeReplying("C024BE91L"))
+	assert.False(t, s.BotTyped("C024BE92L"))
+	assert.False(t, s.BotTypedBeforeReplying("C024BE92L"), "bot replied without typing")
+	assert.Len(t, s.GetTypingIndicators(""), 1)
+}
+
+func TestTypingRelay(t *testing.T) {
+	s := NewTestServer(WithTypingRelay())
+	go s.Start()
+	s.AddToken("xoxp-observer", s.defaultUser.ID)
+	bot := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = bot.Close() }()
+	observer := dialAs(t, s, "xoxp-observer")
+	defer func() { _ = observer.Close() }()
+	waitForClients(s, 2)
+	assert.NoError(t, bot.WriteJSON(slack.OutgoingMessage{ID: 1, Type: "typing", Channel: "C024BE91L"}))
+	evt := slack.UserTypingEvent{}
+	_ = observer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if assert.NoError(t, observer.ReadJSON(&evt)) {
+		assert.Equal(t, "user_typing", evt.Type)
+		assert.Equal(t, s.BotID, evt.User)
+		assert.Equal(t, "C024BE91L", evt.Channel)
+	}
+	_ = bot.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, _, err := bot.ReadMessage()
+	assert.Error(t, err, "the bot should not see its own typing")
+	s.Stop()
+}
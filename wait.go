@@ -0,0 +1,80 @@
+package slacktest
+
+import (
+	"context"
+	"encoding/json"
+
+	slack "github.com/nlopes/slack"
+)
+
+// MessageMatcher reports whether a recorded message is the one being waited for
+type MessageMatcher func(*slack.MessageEvent) bool
+
+// MessageWithText matches messages with exactly the text `text`
+func MessageWithText(text string) MessageMatcher {
+	return func(m *slack.MessageEvent) bool {
+		return m.Text == text
+	}
+}
+
+// MessageInChannel matches messages sent to the channel `channel`
+func MessageInChannel(channel string) MessageMatcher {
+	return func(m *slack.MessageEvent) bool {
+		return m.Channel == channel
+	}
+}
+
+// AllOf matches messages matched by every one of `matchers`
+func AllOf(matchers ...MessageMatcher) MessageMatcher {
+	return func(m *slack.MessageEvent) bool {
+		for _, match := range matchers {
+			if !match(m) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// waitFor blocks until a message matching `match` has been collected or `ctx` is done.
+// Messages collected before waitFor was called are considered as well
+func (mc *messageCollection) waitFor(ctx context.Context, match MessageMatcher) (*slack.MessageEvent, error) {
+	checked := 0
+	for {
+		mc.RLock()
+		pending := mc.messages[checked:]
+		changed := mc.changed
+		mc.RUnlock()
+		for _, m := range pending {
+			if m.Type != "" && m.Type != slack.TYPE_MESSAGE {
+				continue
+			}
+			evt := &slack.MessageEvent{}
+			if err := json.Unmarshal([]byte(m.Raw), evt); err != nil {
+				// This event isn't a message event so we'll skip it
+				continue
+			}
+			if match(evt) {
+				return evt, nil
+			}
+		}
+		checked += len(pending)
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// WaitForMessage blocks until a message matching `match` is received from a websocket
+// client or `ctx` is done, returning the matching message
+func (sts *Server) WaitForMessage(ctx context.Context, match MessageMatcher) (*slack.MessageEvent, error) {
+	return sts.seenInboundMessages.waitFor(ctx, match)
+}
+
+// WaitForOutbound blocks until a message matching `match` is sent to websocket
+// clients or `ctx` is done, returning the matching message
+func (sts *Server) WaitForOutbound(ctx context.Context, match MessageMatcher) (*slack.MessageEvent, error) {
+	return sts.seenOutboundMessages.waitFor(ctx, match)
+}
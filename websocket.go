@@ -0,0 +1,448 @@
+package slacktest
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	websocket "github.com/gorilla/websocket"
+	slack "github.com/nlopes/slack"
+)
+
+// helloEvent is sent to every websocket client as soon as it connects
+const helloEvent = `{"type":"hello"}`
+
+// ConnectionHook is called with the id of a websocket client as it connects or disconnects
+type ConnectionHook func(id string)
+
+// connectionBuffer is the number of messages queued for a connection before delivery waits on it
+const connectionBuffer = 256
+
+// defaultStuckAfter is how long a write can block before the client is considered to have stopped reading
+const defaultStuckAfter = 5 * time.Second
+
+// DeliveryFilter reports whether the event `e` should be sent to a client authenticated as `user`
+type DeliveryFilter func(user string, e RecordedEvent) bool
+
+// rtmConnection is a websocket client connected to the server
+type rtmConnection struct {
+	id string
+	// user is who the client authenticated as
+	user     string
+	outbound chan RecordedEvent
+	conn     *websocket.Conn
+	// done is closed once the connection has been closed
+	done      chan struct{}
+	doneOnce  sync.Once
+	closeOnce sync.Once
+	// pending is the number of events delivered to the connection but not yet written
+	pending int64
+	// writeLock serializes writes since a websocket only supports one writer at a time
+	writeLock sync.Mutex
+	// writeStarted is when the write in progress started in unix nanoseconds, or zero
+	writeStarted int64
+	// viaRTMStart is set when the client connected with a url from rtm.start or rtm.connect
+	viaRTMStart bool
+}
+
+func newRTMConnection(c *websocket.Conn, user string) *rtmConnection {
+	return &rtmConnection{
+		id:       newID("WS"),
+		user:     user,
+		outbound: make(chan RecordedEvent, connectionBuffer),
+		conn:     c,
+		done:     make(chan struct{}),
+	}
+}
+
+func (rc *rtmConnection) write(messageType int, data []byte) error {
+	rc.writeLock.Lock()
+	defer rc.writeLock.Unlock()
+	atomic.StoreInt64(&rc.writeStarted, time.Now().UnixNano())
+	defer atomic.StoreInt64(&rc.writeStarted, 0)
+	return rc.conn.WriteMessage(messageType, data)
+}
+
+// writeBlocked returns how long the write in progress has been waiting on the client
+func (rc *rtmConnection) writeBlocked() time.Duration {
+	started := atomic.LoadInt64(&rc.writeStarted)
+	if started == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, started))
+}
+
+// send queues `e` for the connection, waiting while the queue is full.
+// It gives up and reports false if a write has been blocked for longer than `stuckAfter`
+// since the client has stopped reading
+func (rc *rtmConnection) send(e RecordedEvent, stuckAfter time.Duration) bool {
+	atomic.AddInt64(&rc.pending, 1)
+	select {
+	case rc.outbound <- e:
+		return true
+	default:
+	}
+	ticker := time.NewTicker(stuckAfter / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case rc.outbound <- e:
+			return true
+		case <-rc.done:
+			atomic.AddInt64(&rc.pending, -1)
+			return true
+		case <-ticker.C:
+			if rc.writeBlocked() > stuckAfter {
+				atomic.AddInt64(&rc.pending, -1)
+				return false
+			}
+		}
+	}
+}
+
+// stop marks the connection as closed so nothing more is delivered to it
+func (rc *rtmConnection) stop() {
+	rc.doneOnce.Do(func() { close(rc.done) })
+}
+
+// closeWithCode sends a close frame with `code` and `text` and closes the connection
+func (rc *rtmConnection) closeWithCode(code int, text string) {
+	rc.stop()
+	rc.closeOnce.Do(func() {
+		deadline := time.Now().Add(time.Second)
+		_ = rc.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline)
+		_ = rc.conn.Close()
+	})
+}
+
+// closed reports whether the connection has been closed
+func (rc *rtmConnection) closed() bool {
+	select {
+	case <-rc.done:
+		return true
+	default:
+		return false
+	}
+}
+
+type serverConnections struct {
+	sync.RWMutex
+	conns map[string]*rtmConnection
+	// refuseUntil is when websocket upgrades will be accepted again
+	refuseUntil  time.Time
+	onConnect    []ConnectionHook
+	onDisconnect []ConnectionHook
+	filter       DeliveryFilter
+	// tokens maps api tokens to the user they authenticate as
+	tokens map[string]string
+	// changed is closed and replaced every time a client connects or disconnects
+	changed chan struct{}
+	// issued is the number of rtm.start and rtm.connect urls no client has connected with yet
+	issued int
+	// retired is set once the server stops so new connections are parked
+	retired bool
+	// awaiting is the number of disconnected clients from rtm.start or rtm.connect that haven't reconnected
+	awaiting int
+	// answered is closed once awaiting reaches zero
+	answered chan struct{}
+	// stuckAfter is how long a write can block before the client is considered to have stopped reading
+	stuckAfter time.Duration
+}
+
+func newServerConnections() *serverConnections {
+	return &serverConnections{
+		conns:      make(map[string]*rtmConnection),
+		tokens:     make(map[string]string),
+		changed:    make(chan struct{}),
+		stuckAfter: defaultStuckAfter,
+	}
+}
+
+// add tracks `rc` and returns the hooks to call for it
+func (sc *serverConnections) add(rc *rtmConnection) []ConnectionHook {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.conns[rc.id] = rc
+	close(sc.changed)
+	sc.changed = make(chan struct{})
+	return append([]ConnectionHook(nil), sc.onConnect...)
+}
+
+// remove stops tracking the connection `id` and returns the hooks to call for it.
+// No hooks are returned if the connection was already removed
+func (sc *serverConnections) remove(id string) []ConnectionHook {
+	sc.Lock()
+	defer sc.Unlock()
+	if _, ok := sc.conns[id]; !ok {
+		return nil
+	}
+	delete(sc.conns, id)
+	close(sc.changed)
+	sc.changed = make(chan struct{})
+	return append([]ConnectionHook(nil), sc.onDisconnect...)
+}
+
+func (sc *serverConnections) get(id string) (*rtmConnection, bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+	rc, ok := sc.conns[id]
+	return rc, ok
+}
+
+// all returns the connections ordered by id so the oldest comes first
+func (sc *serverConnections) all() []*rtmConnection {
+	sc.RLock()
+	defer sc.RUnlock()
+	conns := make([]*rtmConnection, 0, len(sc.conns))
+	for _, rc := range sc.conns {
+		conns = append(conns, rc)
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].id < conns[j].id })
+	return conns
+}
+
+// issue records a call to rtm.start or rtm.connect
+func (sc *serverConnections) issue() {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.issued++
+}
+
+// claim reports whether a new connection used a url from rtm.start or rtm.connect
+func (sc *serverConnections) claim() bool {
+	sc.Lock()
+	defer sc.Unlock()
+	if sc.issued == 0 {
+		return false
+	}
+	sc.issued--
+	return true
+}
+
+// retire parks every connection made from now on.
+// The returned channel is closed once every client that connected through rtm.start or rtm.connect has reconnected
+func (sc *serverConnections) retire() <-chan struct{} {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.retired = true
+	sc.awaiting = 0
+	for _, rc := range sc.conns {
+		if rc.viaRTMStart && !rc.closed() {
+			sc.awaiting++
+		}
+	}
+	sc.answered = make(chan struct{})
+	if sc.awaiting == 0 {
+		close(sc.answered)
+	}
+	return sc.answered
+}
+
+// park reports whether a new connection should be parked because the server has stopped
+func (sc *serverConnections) park() bool {
+	sc.Lock()
+	defer sc.Unlock()
+	if !sc.retired {
+		return false
+	}
+	if sc.awaiting > 0 {
+		sc.awaiting--
+		if sc.awaiting == 0 {
+			close(sc.answered)
+		}
+	}
+	return true
+}
+
+// parkConnection holds `c` open without ever writing to it until the client goes away
+func parkConnection(c *websocket.Conn) {
+	defer c.Close()
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (sc *serverConnections) refusing() bool {
+	sc.RLock()
+	defer sc.RUnlock()
+	return time.Now().Before(sc.refuseUntil)
+}
+
+// deliver queues `e` for every connection allowed to see it, waiting on connections that are slow to read.
+// Each connection receives events in the order they were delivered.
+// It returns the connections that stopped reading and so missed `e`. They're stopped so nothing more is delivered to them
+func (sc *serverConnections) deliver(e RecordedEvent) []*rtmConnection {
+	sc.RLock()
+	filter := sc.filter
+	stuckAfter := sc.stuckAfter
+	sc.RUnlock()
+	var stuck []*rtmConnection
+	for _, rc := range sc.all() {
+		if rc.closed() || (filter != nil && !filter(rc.user, e)) {
+			continue
+		}
+		// like Slack, clients aren't told about their own user typing
+		if e.Type == "user_typing" && e.User == rc.user {
+			continue
+		}
+		if !rc.send(e, stuckAfter) {
+			rc.stop()
+			stuck = append(stuck, rc)
+		}
+	}
+	return stuck
+}
+
+// tokenUser returns the user authenticated by `token`. Unknown tokens authenticate as the bot
+func (sts *Server) tokenUser(token string) string {
+	sts.connections.RLock()
+	defer sts.connections.RUnlock()
+	if user, ok := sts.connections.tokens[token]; ok {
+		return user
+	}
+	return sts.BotID
+}
+
+// authenticateRTM points `info` at a websocket url for `token` and sets who the token authenticates as
+func (sts *Server) authenticateRTM(info *slack.Info, token string) {
+	if token != "" {
+		info.URL = info.URL + "?" + url.Values{"token": {token}}.Encode()
+	}
+	user := sts.tokenUser(token)
+	if user == sts.BotID {
+		return
+	}
+	self := &slack.UserDetails{ID: user}
+	if u, ok := findUser(sts.GetUsers(), user); ok {
+		self.Name = u.Name
+	}
+	info.User = self
+}
+
+// connect tracks the new connection `rc`, greets it and calls the connect hooks
+func (sts *Server) connect(rc *rtmConnection) {
+	if err := rc.write(websocket.TextMessage, []byte(helloEvent)); err != nil {
+		log.Printf("error writing hello to websocket: %s", err.Error())
+	}
+	for _, hook := range sts.connections.add(rc) {
+		hook(rc.id)
+	}
+}
+
+// disconnect closes `rc` with `code` and calls the disconnect hooks if it was still tracked
+func (sts *Server) disconnect(rc *rtmConnection, code int, text string) {
+	rc.closeWithCode(code, text)
+	for _, hook := range sts.connections.remove(rc.id) {
+		hook(rc.id)
+	}
+}
+
+// ConnectedClients returns the ids of the websocket clients currently connected, oldest first
+func (sts *Server) ConnectedClients() []string {
+	conns := sts.connections.all()
+	ids := make([]string, len(conns))
+	for i, rc := range conns {
+		ids[i] = rc.id
+	}
+	return ids
+}
+
+// DisconnectClient closes the websocket connection `id` with the close `code` such as websocket.CloseGoingAway
+func (sts *Server) DisconnectClient(id string, code int, text string) error {
+	rc, ok := sts.connections.get(id)
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	sts.disconnect(rc, code, text)
+	return nil
+}
+
+// DisconnectClients closes every websocket connection with the close `code`
+func (sts *Server) DisconnectClients(code int, text string) {
+	for _, rc := range sts.connections.all() {
+		sts.disconnect(rc, code, text)
+	}
+}
+
+// WaitForConnection blocks until a websocket client is connected or `ctx` is done,
+// returning the id of the oldest connected client
+func (sts *Server) WaitForConnection(ctx context.Context) (string, error) {
+	for {
+		sts.connections.RLock()
+		changed := sts.connections.changed
+		sts.connections.RUnlock()
+		if clients := sts.ConnectedClients(); len(clients) > 0 {
+			return clients[0], nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// OnConnect calls `hook` every time a websocket client connects.
+// Hooks are called from the connection's handler and shouldn't block
+func (sts *Server) OnConnect(hook ConnectionHook) {
+	sts.connections.Lock()
+	sts.connections.onConnect = append(sts.connections.onConnect, hook)
+	sts.connections.Unlock()
+}
+
+// OnDisconnect calls `hook` every time a websocket client disconnects or is disconnected.
+// Hooks are called from the connection's handler and shouldn't block
+func (sts *Server) OnDisconnect(hook ConnectionHook) {
+	sts.connections.Lock()
+	sts.connections.onDisconnect = append(sts.connections.onDisconnect, hook)
+	sts.connections.Unlock()
+}
+
+// AddToken makes websocket clients connecting with `token` authenticate as `user`
+// instead of the bot, for example to connect an observer alongside your bot
+func (sts *Server) AddToken(token, user string) {
+	sts.connections.Lock()
+	sts.connections.tokens[token] = user
+	sts.connections.Unlock()
+}
+
+// ClientUser returns the user the websocket client `id` authenticated as
+func (sts *Server) ClientUser(id string) (string, error) {
+	rc, ok := sts.connections.get(id)
+	if !ok {
+		return "", ErrConnectionNotFound
+	}
+	return rc.user, nil
+}
+
+// SetDeliveryFilter only sends events to the clients `filter` allows.
+// Every client receives every event by default, and a nil `filter` restores that
+func (sts *Server) SetDeliveryFilter(filter DeliveryFilter) {
+	sts.connections.Lock()
+	sts.connections.filter = filter
+	sts.connections.Unlock()
+}
+
+// RefuseConnections rejects websocket upgrades with `503 Service Unavailable` for `d`
+func (sts *Server) RefuseConnections(d time.Duration) {
+	sts.connections.Lock()
+	sts.connections.refuseUntil = time.Now().Add(d)
+	sts.connections.Unlock()
+}
+
+// SendGoodbye tells connected clients the server is about to close their connection
+func (sts *Server) SendGoodbye() {
+	sts.SendToWebsocket(`{"type":"goodbye"}`)
+}
+
+// SendTeamMigrationStarted tells connected clients the team is being migrated
+// and they should reconnect
+func (sts *Server) SendTeamMigrationStarted() {
+	sts.SendToWebsocket(`{"type":"team_migration_started"}`)
+}
@@ -0,0 +1,298 @@
+package slacktest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	websocket "github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForClients polls until `n` websocket clients are connected
+func waitForClients(s *Server, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if clients := s.ConnectedClients(); len(clients) == n {
+			return clients
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return s.ConnectedClients()
+}
+
+// connectedEvents starts `rtm` and returns a channel of its connected events
+func connectedEvents(rtm *slack.RTM) chan *slack.ConnectedEvent {
+	connected := make(chan *slack.ConnectedEvent, 10)
+	go rtm.ManageConnection()
+	go func() {
+		for msg := range rtm.IncomingEvents {
+			if ev, ok := msg.Data.(*slack.ConnectedEvent); ok {
+				connected <- ev
+			}
+		}
+	}()
+	return connected
+}
+
+func TestDisconnectClientsReconnects(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	rtm := slack.New("ABCDEFG").NewRTM()
+	connected := connectedEvents(rtm)
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "did not connect in time")
+	}
+	first := waitForClients(s, 1)
+	if !assert.Len(t, first, 1) {
+		t.FailNow()
+	}
+	s.DisconnectClients(websocket.CloseGoingAway, "going away")
+	select {
+	case ev := <-connected:
+		assert.True(t, ev.ConnectionCount > 0, "client should have reconnected")
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "did not reconnect in time")
+	}
+	second := waitForClients(s, 1)
+	if assert.Len(t, second, 1) {
+		assert.NotEqual(t, first[0], second[0], "reconnect should be a new connection")
+	}
+	assert.Len(t, s.APICalls("rtm.start"), 2, "client should call rtm.start again")
+	assert.EqualError(t, s.DisconnectClient(first[0], websocket.CloseNormalClosure, ""), ErrConnectionNotFound.Error())
+	s.Stop()
+}
+
+func TestDisconnectClientWithRTMConnect(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	rtm := slack.New("ABCDEFG").NewRTMWithOptions(&slack.RTMOptions{UseRTMStart: false})
+	connected := connectedEvents(rtm)
+	select {
+	case ev := <-connected:
+		assert.Equal(t, s.BotID, ev.Info.User.ID)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "did not connect in time")
+	}
+	clients := waitForClients(s, 1)
+	if !assert.Len(t, clients, 1) {
+		t.FailNow()
+	}
+	assert.NoError(t, s.DisconnectClient(clients[0], websocket.CloseServiceRestart, "restarting"))
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "did not reconnect in time")
+	}
+	assert.Len(t, s.APICalls("rtm.connect"), 2, "client should call rtm.connect again")
+	s.Stop()
+}
+
+func TestRefuseConnections(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.RefuseConnections(time.Minute)
+	_, resp, err := websocket.DefaultDialer.Dial(s.GetWSURL(), nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	s.RefuseConnections(0)
+	c, _, err := websocket.DefaultDialer.Dial(s.GetWSURL(), nil)
+	if assert.NoError(t, err) {
+		_ = c.Close()
+	}
+	s.Stop()
+}
+
+func TestSendGoodbye(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	c, _, err := websocket.DefaultDialer.Dial(s.GetWSURL(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer func() { _ = c.Close() }()
+	hello := slack.Event{}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, c.ReadJSON(&hello))
+	assert.Equal(t, "hello", hello.Type, "hello should be sent first")
+	s.SendGoodbye()
+	s.SendTeamMigrationStarted()
+	var types []string
+	for i := 0; i < 2; i++ {
+		evt := slack.Event{}
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		assert.NoError(t, c.ReadJSON(&evt))
+		types = append(types, evt.Type)
+	}
+	assert.Equal(t, []string{"goodbye", "team_migration_started"}, types)
+	s.Stop()
+}
+
+func TestConnectionLifecycle(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	connects := make(chan string, 1)
+	disconnects := make(chan string, 1)
+	s.OnConnect(func(id string) { connects <- id })
+	s.OnDisconnect(func(id string) { disconnects <- id })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	waited := make(chan string, 1)
+	go func() {
+		id, err := s.WaitForConnection(ctx)
+		assert.NoError(t, err)
+		waited <- id
+	}()
+	c, _, err := websocket.DefaultDialer.Dial(s.GetWSURL(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	id := <-connects
+	assert.Equal(t, id, <-waited)
+	assert.Equal(t, []string{id}, s.ConnectedClients())
+
+	// closing the client side should end the connection on the server
+	_ = c.Close()
+	select {
+	case gone := <-disconnects:
+		assert.Equal(t, id, gone)
+	case <-ctx.Done():
+		assert.FailNow(t, "server did not notice the client disconnecting")
+	}
+	assert.Len(t, s.ConnectedClients(), 0)
+
+	c, _, err = websocket.DefaultDialer.Dial(s.GetWSURL(), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer func() { _ = c.Close() }()
+	id = <-connects
+	s.Stop()
+	assert.Equal(t, id, <-disconnects, "stopping the server should disconnect clients")
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "client should see the server going away")
+			break
+		}
+	}
+}
+
+func TestStopParksReconnectingClients(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	slack.SLACK_API = s.GetAPIURL()
+	rtm := slack.New("ABCDEFG").NewRTM()
+	connected := connectedEvents(rtm)
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "did not connect in time")
+	}
+	s.Stop()
+	select {
+	case ev := <-connected:
+		assert.Equal(t, 2, ev.ConnectionCount, "client should have reconnected to the stopped server")
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "did not reconnect in time")
+	}
+	assert.Len(t, s.ConnectedClients(), 0, "parked clients shouldn't be tracked")
+	assert.Len(t, s.APICalls("rtm.start"), 2, "client should have called rtm.start on the stopped server")
+}
+
+func TestWaitForConnectionTimeout(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := s.WaitForConnection(ctx)
+	assert.EqualError(t, err, context.DeadlineExceeded.Error())
+	s.Stop()
+}
+
+// dialAs connects a raw websocket client with `token` and reads the hello event
+func dialAs(t *testing.T, s *Server, token string) *websocket.Conn {
+	c, _, err := websocket.DefaultDialer.Dial(s.GetWSURL()+"?token="+token, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	hello := slack.Event{}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, c.ReadJSON(&hello))
+	return c
+}
+
+// readTexts reads `n` messages from `c` and returns their text
+func readTexts(t *testing.T, c *websocket.Conn, n int) []string {
+	var texts []string
+	for i := 0; i < n; i++ {
+		m := slack.Message{}
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if !assert.NoError(t, c.ReadJSON(&m)) {
+			break
+		}
+		texts = append(texts, m.Text)
+	}
+	return texts
+}
+
+func TestBroadcastToEveryClient(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddToken("xoxp-observer", s.defaultUser.ID)
+	bot := dialAs(t, s, "xoxb-bot")
+	defer func() { _ = bot.Close() }()
+	observer := dialAs(t, s, "xoxp-observer")
+	defer func() { _ = observer.Close() }()
+	clients := waitForClients(s, 2)
+	if !assert.Len(t, clients, 2) {
+		t.FailNow()
+	}
+	user, err := s.ClientUser(clients[0])
+	assert.NoError(t, err)
+	assert.Equal(t, s.BotID, user, "unknown tokens should authenticate as the bot")
+	user, _ = s.ClientUser(clients[1])
+	assert.Equal(t, s.defaultUser.ID, user)
+
+	s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"one"}`)
+	expected := []string{"one"}
+	assert.Equal(t, expected, readTexts(t, bot, 1))
+	assert.Equal(t, expected, readTexts(t, observer, 1))
+
+	s.SetDeliveryFilter(func(user string, e RecordedEvent) bool {
+		return user == s.BotID
+	})
+	s.SendToWebsocket(`{"type":"message","channel":"C024BE91L","text":"bot only"}`)
+	assert.Equal(t, []string{"bot only"}, readTexts(t, bot, 1))
+	_ = observer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, _, err = observer.ReadMessage()
+	assert.Error(t, err, "observer should not see filtered events")
+	s.SetDeliveryFilter(nil)
+	s.Stop()
+}
+
+func TestRTMStartAuthenticatesToken(t *testing.T) {
+	s := NewTestServer()
+	go s.Start()
+	s.AddToken("xoxp-observer", s.defaultUser.ID)
+	slack.SLACK_API = s.GetAPIURL()
+	info, wsurl, err := slack.New("xoxp-observer").StartRTM()
+	if assert.NoError(t, err) {
+		assert.Equal(t, s.defaultUser.ID, info.User.ID)
+		assert.Equal(t, s.defaultUser.Name, info.User.Name)
+		assert.Contains(t, wsurl, "token=xoxp-observer")
+	}
+	info, _, err = slack.New("ABCDEFG").StartRTM()
+	if assert.NoError(t, err) {
+		assert.Equal(t, s.BotID, info.User.ID)
+	}
+	s.Stop()
+}
@@ -0,0 +1,231 @@
+package slacktest
+
+import (
+	slack "github.com/nlopes/slack"
+)
+
+// copyChannel returns a copy of `c` that doesn't share its members with the original
+func copyChannel(c slack.Channel) slack.Channel {
+	c.Members = append([]string(nil), c.Members...)
+	return c
+}
+
+// copyGroup returns a copy of `g` that doesn't share its members with the original
+func copyGroup(g slack.Group) slack.Group {
+	g.Members = append([]string(nil), g.Members...)
+	return g
+}
+
+func (sc *serverChannels) all() []slack.Channel {
+	sc.RLock()
+	defer sc.RUnlock()
+	channels := make([]slack.Channel, 0, len(sc.channels))
+	for _, c := range sc.channels {
+		channels = append(channels, copyChannel(c))
+	}
+	return channels
+}
+
+func (sc *serverChannels) add(c slack.Channel) {
+	sc.Lock()
+	defer sc.Unlock()
+	for i := range sc.channels {
+		if sc.channels[i].ID == c.ID {
+			sc.channels[i] = copyChannel(c)
+			return
+		}
+	}
+	sc.channels = append(sc.channels, copyChannel(c))
+}
+
+// create adds `c` unless a channel with the same name already exists
+func (sc *serverChannels) create(c slack.Channel) bool {
+	sc.Lock()
+	defer sc.Unlock()
+	for i := range sc.channels {
+		if sc.channels[i].Name == c.Name {
+			return false
+		}
+	}
+	sc.channels = append(sc.channels, copyChannel(c))
+	return true
+}
+
+// byName returns the channel with the given name
+func (sc *serverChannels) byName(name string) (slack.Channel, bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+	for _, c := range sc.channels {
+		if c.Name == name {
+			return copyChannel(c), true
+		}
+	}
+	return slack.Channel{}, false
+}
+
+func (sc *serverChannels) get(id string) (slack.Channel, bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+	for _, c := range sc.channels {
+		if c.ID == id {
+			return copyChannel(c), true
+		}
+	}
+	return slack.Channel{}, false
+}
+
+func (sc *serverChannels) remove(id string) bool {
+	sc.Lock()
+	defer sc.Unlock()
+	for i := range sc.channels {
+		if sc.channels[i].ID == id {
+			sc.channels = append(sc.channels[:i], sc.channels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// update calls `f` with the channel matching `id` while holding the lock
+func (sc *serverChannels) update(id string, f func(*slack.Channel)) bool {
+	sc.Lock()
+	defer sc.Unlock()
+	for i := range sc.channels {
+		if sc.channels[i].ID == id {
+			f(&sc.channels[i])
+			return true
+		}
+	}
+	return false
+}
+
+func (sg *serverGroups) all() []slack.Group {
+	sg.RLock()
+	defer sg.RUnlock()
+	groups := make([]slack.Group, 0, len(sg.channels))
+	for _, g := range sg.channels {
+		groups = append(groups, copyGroup(g))
+	}
+	return groups
+}
+
+func (sg *serverGroups) add(g slack.Group) {
+	sg.Lock()
+	defer sg.Unlock()
+	for i := range sg.channels {
+		if sg.channels[i].ID == g.ID {
+			sg.channels[i] = copyGroup(g)
+			return
+		}
+	}
+	sg.channels = append(sg.channels, copyGroup(g))
+}
+
+func (sg *serverGroups) remove(id string) bool {
+	sg.Lock()
+	defer sg.Unlock()
+	for i := range sg.channels {
+		if sg.channels[i].ID == id {
+			sg.channels = append(sg.channels[:i], sg.channels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// update calls `f` with the group matching `id` while holding the lock
+func (sg *serverGroups) update(id string, f func(*slack.Group)) bool {
+	sg.Lock()
+	defer sg.Unlock()
+	for i := range sg.channels {
+		if sg.channels[i].ID == id {
+			f(&sg.channels[i])
+			return true
+		}
+	}
+	return false
+}
+
+func (su *serverUsers) all() []slack.User {
+	su.RLock()
+	defer su.RUnlock()
+	users := make([]slack.User, len(su.users))
+	copy(users, su.users)
+	return users
+}
+
+func (su *serverUsers) add(u slack.User) {
+	su.Lock()
+	defer su.Unlock()
+	for i := range su.users {
+		if su.users[i].ID == u.ID {
+			su.users[i] = u
+			return
+		}
+	}
+	su.users = append(su.users, u)
+}
+
+// update calls `f` with the user matching `id` while holding the lock
+func (su *serverUsers) update(id string, f func(*slack.User)) bool {
+	su.Lock()
+	defer su.Unlock()
+	for i := range su.users {
+		if su.users[i].ID == id {
+			f(&su.users[i])
+			return true
+		}
+	}
+	return false
+}
+
+// hasMember checks if `id` is in `members`
+func hasMember(members []string, id string) bool {
+	for _, m := range members {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+// removeMember returns `members` without `id`
+func removeMember(members []string, id string) []string {
+	var remaining []string
+	for _, m := range members {
+		if m != id {
+			remaining = append(remaining, m)
+		}
+	}
+	return remaining
+}
+
+// findUser returns the user with `id` from `users`
+func findUser(users []slack.User, id string) (slack.User, bool) {
+	for _, u := range users {
+		if u.ID == id {
+			return u, true
+		}
+	}
+	return slack.User{}, false
+}
+
+// findChannel returns the channel with `id` from `channels`
+func findChannel(channels []slack.Channel, id string) (slack.Channel, bool) {
+	for _, c := range channels {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return slack.Channel{}, false
+}
+
+// findGroup returns the group with `id` from `groups`
+func findGroup(groups []slack.Group, id string) (slack.Group, bool) {
+	for _, g := range groups {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return slack.Group{}, false
+}